@@ -0,0 +1,134 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+func GetBucketLogging(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#GetBucketLogging: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	// buckets without logging have an empty status
+	var status S.BucketLoggingStatus
+	if _, err := readBucketConfig(app, r.Bucket, "logging", &status); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.RespondXML(w, http.StatusOK, status)
+}
+
+func PutBucketLogging(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutBucketLogging: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var status S.BucketLoggingStatus
+	if err := decodeXMLBody(req, &status); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Bucket)
+	}
+
+	if status.LoggingEnabled == nil {
+		if err := deleteBucketConfig(app, r.Bucket, "logging"); err != nil {
+			return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+		}
+		return app.Respond(w, http.StatusOK, nil, nil)
+	}
+
+	target := status.LoggingEnabled.TargetBucket
+	if len(target) == 0 || strings.Contains(target, "/") {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidTargetBucketForLogging", errors.New("invalid target bucket"), r.Bucket)
+	}
+	if _, err := app.Backend.HeadBucket(target); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidTargetBucketForLogging", errors.New("target bucket does not exist"), r.Bucket)
+	}
+
+	if err := writeBucketConfig(app, r.Bucket, "logging", status); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusOK, nil, nil)
+}
+
+// AccessLog records the requests to buckets with logging enabled.
+type AccessLog struct {
+	App  *S.App
+	Next http.Handler
+}
+
+func (a AccessLog) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	id := make([]byte, 8)
+	rand.Read(id)
+	requestID := strings.ToUpper(hex.EncodeToString(id))
+	w.Header().Set("X-Amz-Request-Id", requestID)
+
+	lw := &S.AccessLogWriter{ResponseWriter: w}
+	a.Next.ServeHTTP(lw, req)
+
+	bucket, _, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	if len(bucket) == 0 || bucket == *a.App.Metadata || strings.Contains(bucket, "..") {
+		return
+	}
+	var status S.BucketLoggingStatus
+	found, err := readBucketConfig(a.App, bucket, "logging", &status)
+	if err != nil {
+		log.Printf("can not read logging configuration of %s: %v", bucket, err)
+		return
+	}
+	if !found || status.LoggingEnabled == nil {
+		return
+	}
+
+	record := S.NewAccessLogRecord(a.App, req, lw, requestID, start, time.Now())
+	a.App.AccessLogs.Add(*status.LoggingEnabled, record.String())
+}
+
+func AccessLogWorker(ctx context.Context, app *S.App, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			FlushAccessLogs(app, time.Now())
+			return
+		case <-time.After(interval):
+		}
+		FlushAccessLogs(app, time.Now())
+	}
+}
+
+// FlushAccessLogs writes the buffered records of each target as a log
+// object <TargetPrefix>YYYY-mm-DD-HH-MM-SS-<random>.
+func FlushAccessLogs(app *S.App, now time.Time) {
+	for target, lines := range app.AccessLogs.Take() {
+		suffix := make([]byte, 8)
+		rand.Read(suffix)
+		key := target.TargetPrefix + now.UTC().Format("2006-01-02-15-04-05") + "-" + strings.ToUpper(hex.EncodeToString(suffix))
+
+		meta := S.ObjectMeta{ContentType: "text/plain"}
+		if err := applyEncryption(app, target.TargetBucket, key, http.Header{}, &meta, nil); err != nil {
+			log.Printf("can not write access log %s/%s: %v", target.TargetBucket, key, err)
+			continue
+		}
+		body := strings.NewReader(strings.Join(lines, "\n") + "\n")
+		if _, err := putObjectData(app, target.TargetBucket, key, body, meta, nil, false); err != nil {
+			log.Printf("can not write access log %s/%s: %v", target.TargetBucket, key, err)
+		}
+	}
+}
@@ -4,9 +4,12 @@
 package handlers
 
 import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
 	"log"
 	"net/http"
-	"os"
 
 	S "github.com/autovia/s3-go/structs"
 )
@@ -14,17 +17,14 @@ import (
 func ListBuckets(app *S.App, w http.ResponseWriter, req *http.Request) error {
 	log.Printf("#ListBuckets %v\n", req)
 
-	files, err := os.ReadDir(*app.Mount)
+	infos, err := app.Backend.ListBuckets()
 	if err != nil {
 		return app.RespondError(w, 500, "InternalError", err, "")
 	}
 
 	buckets := []S.Bucket{}
-	for _, file := range files {
-		fileInfo, _ := file.Info()
-		if file.IsDir() && fileInfo.Name() != *app.Metadata {
-			buckets = append(buckets, S.Bucket{Name: fileInfo.Name(), CreationDate: fileInfo.ModTime()})
-		}
+	for _, info := range infos {
+		buckets = append(buckets, S.Bucket{Name: info.Name, CreationDate: info.CreationDate})
 	}
 
 	bucketList := S.ListAllMyBucketsResult{
@@ -35,15 +35,23 @@ func ListBuckets(app *S.App, w http.ResponseWriter, req *http.Request) error {
 	return app.RespondXML(w, http.StatusOK, bucketList)
 }
 
-func CreateBucket(app *S.App, w http.ResponseWriter, r *S.Request) error {
+func CreateBucket(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
 	log.Printf("#CreateBucket: %v\n", r)
 
-	if _, err := os.Stat(r.Path); !os.IsNotExist(err) {
+	if err := app.Backend.CreateBucket(r.Bucket); errors.Is(err, fs.ErrExist) {
 		return app.RespondError(w, 409, "BucketAlreadyExists", err, r.Bucket)
+	} else if err != nil {
+		return app.RespondError(w, 500, "InternalError", err, r.Bucket)
 	}
 
-	if err := os.Mkdir(r.Path, os.ModePerm); err != nil {
-		return app.RespondError(w, 500, "InternalError", err, r.Bucket)
+	// object lock can only be enabled at creation and requires versioning
+	if req.Header.Get("X-Amz-Bucket-Object-Lock-Enabled") == "true" {
+		if err := writeBucketConfig(app, r.Bucket, "versioning", S.VersioningConfiguration{Status: "Enabled"}); err != nil {
+			return app.RespondError(w, 500, "InternalError", err, r.Bucket)
+		}
+		if err := writeBucketConfig(app, r.Bucket, "object-lock", S.ObjectLockConfiguration{ObjectLockEnabled: "Enabled"}); err != nil {
+			return app.RespondError(w, 500, "InternalError", err, r.Bucket)
+		}
 	}
 
 	return app.RespondXML(w, http.StatusOK, nil)
@@ -52,7 +60,7 @@ func CreateBucket(app *S.App, w http.ResponseWriter, r *S.Request) error {
 func HeadBucket(app *S.App, w http.ResponseWriter, r *S.Request) error {
 	log.Printf("#HeadBucket: %v\n", r)
 
-	if _, err := os.Stat(r.Path); os.IsNotExist(err) {
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
 		return app.RespondError(w, 400, "NoSuchBucket", err, r.Bucket)
 	}
 
@@ -62,28 +70,61 @@ func HeadBucket(app *S.App, w http.ResponseWriter, r *S.Request) error {
 func GetBucketVersioning(app *S.App, w http.ResponseWriter, r *S.Request) error {
 	log.Printf("#GetBucketVersioning: %v\n", r)
 
-	return app.RespondXML(w, http.StatusOK, S.VersioningConfiguration{Status: "Suspended"})
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	return app.RespondXML(w, http.StatusOK, S.VersioningConfiguration{Status: bucketVersioning(app, r.Bucket)})
 }
 
-func DeleteBucket(app *S.App, w http.ResponseWriter, r *S.Request) error {
-	log.Printf("#DeleteBucket: %v\n", r)
+func PutBucketVersioning(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutBucketVersioning: %v\n", r)
 
-	if _, err := os.Stat(r.Path); os.IsNotExist(err) {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
 	}
 
-	contents, err := os.ReadDir(r.Path)
-	if err != nil {
+	var config S.VersioningConfiguration
+	if err := decodeXMLBody(req, &config); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Bucket)
+	}
+	if config.Status != "Enabled" && config.Status != "Suspended" {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", errors.New("invalid versioning status"), r.Bucket)
+	}
+	if _, locked := objectLockEnabled(app, r.Bucket); locked && config.Status == "Suspended" {
+		return app.RespondError(w, http.StatusConflict, "InvalidBucketState", errors.New("versioning can not be suspended on object lock enabled buckets"), r.Bucket)
+	}
+	if _, err := app.Backend.ReadMetadata(bucketConfigName(r.Bucket, "replication")); err == nil && config.Status == "Suspended" {
+		return app.RespondError(w, http.StatusConflict, "InvalidBucketState", errors.New("versioning can not be suspended on buckets with replication"), r.Bucket)
+	}
+
+	if err := writeBucketConfig(app, r.Bucket, "versioning", S.VersioningConfiguration{Status: config.Status}); err != nil {
 		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
 	}
 
-	if len(contents) > 0 {
+	return app.Respond(w, http.StatusOK, nil, nil)
+}
+
+func DeleteBucket(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#DeleteBucket: %v\n", r)
+
+	err := app.Backend.DeleteBucket(r.Bucket)
+	if errors.Is(err, S.ErrBucketNotEmpty) {
 		return app.RespondError(w, http.StatusConflict, "BucketNotEmpty", err, r.Bucket)
 	}
-
-	if err := os.Remove(r.Path); err != nil {
+	if err != nil {
 		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
 	}
 
 	return app.RespondXML(w, http.StatusNoContent, nil)
 }
+
+// decodeXMLBody reads a configuration document from the request body.
+func decodeXMLBody(req *http.Request, v any) error {
+	defer req.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(req.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(body, v)
+}
@@ -0,0 +1,146 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"strings"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+func GetBucketCors(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#GetBucketCors: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var config S.CORSConfiguration
+	found, err := readBucketConfig(app, r.Bucket, "cors", &config)
+	if err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+	if !found {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchCORSConfiguration", errors.New("cors configuration does not exist"), r.Bucket)
+	}
+
+	return app.RespondXML(w, http.StatusOK, config)
+}
+
+func PutBucketCors(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutBucketCors: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var config S.CORSConfiguration
+	if err := decodeXMLBody(req, &config); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Bucket)
+	}
+	if err := config.Validate(); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", err, r.Bucket)
+	}
+
+	if err := writeBucketConfig(app, r.Bucket, "cors", config); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusOK, nil, nil)
+}
+
+func DeleteBucketCors(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#DeleteBucketCors: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	if err := deleteBucketConfig(app, r.Bucket, "cors"); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusNoContent, nil, nil)
+}
+
+// PreflightRequest evaluates a browser preflight request against the
+// CORS rules of the bucket.
+func PreflightRequest(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PreflightRequest: %v\n", r)
+
+	origin := req.Header.Get("Origin")
+	method := req.Header.Get("Access-Control-Request-Method")
+	if len(origin) == 0 || len(method) == 0 {
+		return app.RespondError(w, http.StatusBadRequest, "BadRequest", errors.New("insufficient information, origin and request method needed"), r.Bucket)
+	}
+
+	var config S.CORSConfiguration
+	found, err := readBucketConfig(app, r.Bucket, "cors", &config)
+	if err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+	if !found {
+		return app.RespondError(w, http.StatusForbidden, "AccessForbidden", errors.New("cors is not enabled for this bucket"), r.Bucket)
+	}
+
+	var headers []string
+	if requested := req.Header.Get("Access-Control-Request-Headers"); len(requested) > 0 {
+		headers = strings.Split(requested, ",")
+	}
+
+	rule := config.Match(origin, method, headers)
+	if rule == nil {
+		return app.RespondError(w, http.StatusForbidden, "AccessForbidden", errors.New("cors request is not allowed"), r.Bucket)
+	}
+
+	response := rule.Headers(origin)
+	if len(headers) > 0 {
+		response["Access-Control-Allow-Headers"] = req.Header.Get("Access-Control-Request-Headers")
+	}
+	return app.Respond(w, http.StatusOK, response, nil)
+}
+
+// CORS adds the headers of the matching CORS rule to every response,
+// including the errors of authentication, so browsers can read them.
+type CORS struct {
+	App  *S.App
+	Next http.Handler
+}
+
+func (c CORS) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// preflight requests are answered by PreflightRequest
+	if !S.IsPreflight(req) {
+		corsHeaders(c.App, w, req)
+	}
+	c.Next.ServeHTTP(w, req)
+}
+
+// corsHeaders adds the Access-Control-* headers to the response of a
+// request from a browser if a CORS rule of the bucket allows it.
+func corsHeaders(app *S.App, w http.ResponseWriter, req *http.Request) {
+	origin := req.Header.Get("Origin")
+	bucket, _, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	if len(origin) == 0 || len(bucket) == 0 {
+		return
+	}
+
+	var config S.CORSConfiguration
+	found, err := readBucketConfig(app, bucket, "cors", &config)
+	if err != nil {
+		log.Printf("can not read cors configuration of %s: %v", bucket, err)
+	}
+	if !found {
+		return
+	}
+
+	if rule := config.Match(origin, req.Method, nil); rule != nil {
+		for k, v := range rule.Headers(origin) {
+			w.Header().Set(k, v)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+var (
+	errEncryptionNotConfigured  = errors.New("server side encryption is not configured")
+	errInsecureCustomerKey      = errors.New("requests specifying server side encryption with customer provided keys must be made over a secure connection")
+	errCustomerKeyRequired      = errors.New("the object was stored using a customer provided key, the key must be provided")
+	errCustomerKeyMismatch      = errors.New("the provided customer key does not match the object")
+	errCustomerKeyNotApplicable = errors.New("the encryption parameters are not applicable to this object")
+)
+
+func GetBucketEncryption(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#GetBucketEncryption: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var config S.ServerSideEncryptionConfiguration
+	found, err := readBucketConfig(app, r.Bucket, "encryption", &config)
+	if err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+	if !found {
+		return app.RespondError(w, http.StatusNotFound, "ServerSideEncryptionConfigurationNotFoundError", errors.New("encryption configuration does not exist"), r.Bucket)
+	}
+
+	return app.RespondXML(w, http.StatusOK, config)
+}
+
+func PutBucketEncryption(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutBucketEncryption: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var config S.ServerSideEncryptionConfiguration
+	if err := decodeXMLBody(req, &config); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Bucket)
+	}
+	if len(config.Rules) != 1 || config.Rules[0].ApplyServerSideEncryptionByDefault == nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", errors.New("exactly one rule with a default encryption is required"), r.Bucket)
+	}
+	byDefault := config.Rules[0].ApplyServerSideEncryptionByDefault
+	if err := validEncryption(app, byDefault.SSEAlgorithm, byDefault.KMSMasterKeyID); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, r.Bucket)
+	}
+
+	if err := writeBucketConfig(app, r.Bucket, "encryption", config); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusOK, nil, nil)
+}
+
+func DeleteBucketEncryption(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#DeleteBucketEncryption: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	if err := deleteBucketConfig(app, r.Bucket, "encryption"); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusNoContent, nil, nil)
+}
+
+func validEncryption(app *S.App, algorithm string, kmsKeyID string) error {
+	switch algorithm {
+	case "AES256":
+		if len(kmsKeyID) > 0 {
+			return errors.New("a KMS key can only be used with aws:kms encryption")
+		}
+		if app.MasterKey == nil {
+			return errEncryptionNotConfigured
+		}
+	case "aws:kms":
+		if app.KMS == nil {
+			return errEncryptionNotConfigured
+		}
+		if _, err := app.KMS.Lookup(kmsKeyID); err != nil {
+			return err
+		}
+	default:
+		return errors.New("unsupported server side encryption " + algorithm)
+	}
+	return nil
+}
+
+// customerKey returns the SSE-C key of a request or nil. Customer keys
+// are only accepted over TLS.
+func customerKey(req *http.Request, prefix string) ([]byte, error) {
+	key, err := S.ParseCustomerKey(req.Header, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil && req.TLS == nil {
+		return nil, errInsecureCustomerKey
+	}
+	return key, nil
+}
+
+// checkCustomerKey verifies the customer key of a request against a version.
+func checkCustomerKey(meta *S.ObjectMeta, key []byte) error {
+	switch {
+	case len(meta.SSECustomerAlgorithm) == 0 && key != nil:
+		return errCustomerKeyNotApplicable
+	case len(meta.SSECustomerAlgorithm) == 0:
+		return nil
+	case key == nil:
+		return errCustomerKeyRequired
+	case !S.VerifyCustomerKey(key, meta.SSECustomerKeyHash):
+		return errCustomerKeyMismatch
+	}
+	return nil
+}
+
+// customerKeyHeaders returns the SSE-C response headers of a request.
+func customerKeyHeaders(req *http.Request, headers map[string]string) {
+	if md5 := req.Header.Get(S.SSECustomerPrefix + "Key-Md5"); len(md5) > 0 {
+		headers[S.SSECustomerPrefix+"Algorithm"] = "AES256"
+		headers[S.SSECustomerPrefix+"Key-Md5"] = md5
+	}
+}
+
+// applyEncryption selects the encryption of a new version from the
+// customer key, the x-amz-server-side-encryption headers or the bucket default.
+func applyEncryption(app *S.App, bucket string, key string, header http.Header, meta *S.ObjectMeta, customerKey []byte) error {
+	algorithm := header.Get("X-Amz-Server-Side-Encryption")
+	kmsKeyID := header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id")
+	if customerKey != nil {
+		if len(algorithm) > 0 {
+			return errors.New("server side encryption and customer provided keys can not be combined")
+		}
+		meta.SSECustomerAlgorithm = "AES256"
+		meta.SSECustomerKeyHash = S.HashCustomerKey(customerKey)
+		return nil
+	}
+
+	if len(algorithm) == 0 {
+		if len(kmsKeyID) > 0 {
+			return errors.New("a KMS key can only be used with aws:kms encryption")
+		}
+		var config S.ServerSideEncryptionConfiguration
+		found, err := readBucketConfig(app, bucket, "encryption", &config)
+		if err != nil {
+			return err
+		}
+		if !found || len(config.Rules) == 0 || config.Rules[0].ApplyServerSideEncryptionByDefault == nil {
+			return nil
+		}
+		algorithm = config.Rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm
+		kmsKeyID = config.Rules[0].ApplyServerSideEncryptionByDefault.KMSMasterKeyID
+	}
+
+	if err := validEncryption(app, algorithm, kmsKeyID); err != nil {
+		return err
+	}
+	meta.SSE = algorithm
+
+	if algorithm == "aws:kms" {
+		kmsKey, _ := app.KMS.Lookup(kmsKeyID)
+		meta.SSEKMSKeyID = kmsKey.Arn()
+
+		// like S3 the object ARN is the default encryption context
+		context, err := S.ParseEncryptionContext(header.Get("X-Amz-Server-Side-Encryption-Context"))
+		if err != nil {
+			return err
+		}
+		if len(context) == 0 {
+			context["aws:s3:arn"] = "arn:aws:s3:::" + bucket + "/" + key
+		}
+		meta.SSEContext = S.EncodeEncryptionContext(context)
+	}
+	return nil
+}
+
+// wrappingKey returns the key and additional data wrapping the data key of
+// a version or nil if the version is not encrypted.
+func wrappingKey(app *S.App, meta *S.ObjectMeta, customerKey []byte) ([]byte, []byte, error) {
+	switch {
+	case len(meta.SSECustomerAlgorithm) > 0:
+		if customerKey == nil {
+			return nil, nil, errCustomerKeyRequired
+		}
+		return customerKey, nil, nil
+	case meta.SSE == "AES256":
+		if app.MasterKey == nil {
+			return nil, nil, errEncryptionNotConfigured
+		}
+		return app.MasterKey, nil, nil
+	case meta.SSE == "aws:kms":
+		if app.KMS == nil {
+			return nil, nil, errEncryptionNotConfigured
+		}
+		kmsKey, err := app.KMS.Lookup(meta.SSEKMSKeyID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return kmsKey.Key, []byte(meta.SSEContext), nil
+	}
+	return nil, nil, nil
+}
+
+// encryptionKey creates the data key of a new encrypted version and stores
+// it wrapped in meta. It returns nil for unencrypted versions.
+func encryptionKey(app *S.App, meta *S.ObjectMeta, customerKey []byte) ([]byte, error) {
+	wrapping, additionalData, err := wrappingKey(app, meta, customerKey)
+	if wrapping == nil || err != nil {
+		return nil, err
+	}
+
+	key := S.NewDataKey()
+	wrapped, err := S.WrapKey(wrapping, key, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	meta.SSEKey = wrapped
+	return key, nil
+}
+
+// encryptionHeaders adds the server side encryption response headers of a version.
+func encryptionHeaders(meta *S.ObjectMeta, headers map[string]string) {
+	if len(meta.SSE) > 0 {
+		headers["X-Amz-Server-Side-Encryption"] = meta.SSE
+	}
+	if len(meta.SSEKMSKeyID) > 0 {
+		headers["X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"] = meta.SSEKMSKeyID
+	}
+	if len(meta.SSECustomerAlgorithm) > 0 {
+		headers[S.SSECustomerPrefix+"Algorithm"] = meta.SSECustomerAlgorithm
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// openObjectData returns the plaintext of the i-th version of a key from
+// offset on. Versions encrypted with a customer key require the key.
+func openObjectData(app *S.App, bucket string, idx *S.ObjectIndex, i int, offset int64, customerKey []byte) (io.ReadCloser, error) {
+	meta := idx.Versions[i]
+	if err := checkCustomerKey(&meta, customerKey); err != nil {
+		return nil, err
+	}
+
+	wrapping, additionalData, err := wrappingKey(app, &meta, customerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := app.Backend.OpenObject(bucket, idx.Key, dataVersion(idx, i))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errNoSuchKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if wrapping == nil {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return file, nil
+	}
+
+	key, err := S.UnwrapKey(wrapping, meta.SSEKey, additionalData)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(S.EncryptedOffset(offset), io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	plain, err := S.NewDecryptReader(file, key, meta.Size, offset)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return readCloser{plain, file}, nil
+}
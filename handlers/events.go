@@ -0,0 +1,99 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+const eventKeepAlive = 15 * time.Second
+
+// ListenBucketEvents streams the events of a bucket until the client
+// disconnects, as Server-Sent Events if requested by the Accept header or
+// format=sse and as newline delimited JSON otherwise.
+func ListenBucketEvents(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#ListenBucketEvents: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+	if app.Events == nil {
+		return app.RespondError(w, http.StatusNotImplemented, "NotImplemented", errors.New("event streams are disabled"), r.Bucket)
+	}
+
+	// the subresource itself is the first, empty events value
+	query := req.URL.Query()
+	events := []string{}
+	for _, v := range query["events"] {
+		if len(v) > 0 {
+			events = append(events, v)
+		}
+	}
+	filter, err := S.ParseEventFilter(strings.Join(events, ","), query.Get("prefix"), query.Get("suffix"))
+	if err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, r.Bucket)
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", errors.New("streaming not supported"), r.Bucket)
+	}
+
+	sse := query.Get("format") == "sse" || strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	s := app.Events.Subscribe(r.Bucket, filter)
+	defer app.Events.Unsubscribe(s)
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return nil
+		case <-keepAlive.C:
+			ping := "\n"
+			if sse {
+				ping = ": ping\n\n"
+			}
+			if _, err := w.Write([]byte(ping)); err != nil {
+				return err
+			}
+		case event, ok := <-s.C:
+			if !ok {
+				log.Printf("event subscriber of %s fell behind, disconnecting", r.Bucket)
+				return nil
+			}
+			b, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if sse {
+				_, err = w.Write([]byte("event: " + event.Records[0].EventName + "\ndata: " + string(b) + "\n\n"))
+			} else {
+				_, err = w.Write(append(b, '\n'))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+	}
+}
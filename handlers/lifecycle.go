@@ -0,0 +1,187 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"time"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+func GetBucketLifecycleConfiguration(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#GetBucketLifecycleConfiguration: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var config S.LifecycleConfiguration
+	found, err := readBucketConfig(app, r.Bucket, "lifecycle", &config)
+	if err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+	if !found {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchLifecycleConfiguration", errors.New("lifecycle configuration does not exist"), r.Bucket)
+	}
+
+	return app.RespondXML(w, http.StatusOK, config)
+}
+
+func PutBucketLifecycleConfiguration(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutBucketLifecycleConfiguration: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var config S.LifecycleConfiguration
+	if err := decodeXMLBody(req, &config); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Bucket)
+	}
+	if err := config.Validate(); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, r.Bucket)
+	}
+
+	if err := writeBucketConfig(app, r.Bucket, "lifecycle", config); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusOK, nil, nil)
+}
+
+func DeleteBucketLifecycle(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#DeleteBucketLifecycle: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	if err := deleteBucketConfig(app, r.Bucket, "lifecycle"); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusNoContent, nil, nil)
+}
+
+// LifecycleWorker applies the lifecycle rules of all buckets every interval.
+func LifecycleWorker(ctx context.Context, app *S.App, interval time.Duration) {
+	for {
+		ExpireObjects(app, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// ExpireObjects runs a single lifecycle pass over all buckets.
+func ExpireObjects(app *S.App, now time.Time) {
+	buckets, err := app.Backend.ListBuckets()
+	if err != nil {
+		log.Printf("lifecycle: can not list buckets: %v", err)
+		return
+	}
+
+	for _, bucket := range buckets {
+		var config S.LifecycleConfiguration
+		found, err := readBucketConfig(app, bucket.Name, "lifecycle", &config)
+		if err != nil {
+			log.Printf("lifecycle: can not read configuration of %s: %v", bucket.Name, err)
+			continue
+		}
+		if !found {
+			continue
+		}
+
+		keys, err := app.Backend.ListKeys(bucket.Name, "")
+		if err != nil {
+			log.Printf("lifecycle: can not list %s: %v", bucket.Name, err)
+			continue
+		}
+		for _, key := range keys {
+			if err := expireKey(app, bucket.Name, key, config.Rules, now); err != nil {
+				log.Printf("lifecycle: can not expire %s/%s: %v", bucket.Name, key, err)
+			}
+		}
+	}
+}
+
+// expireKey applies the rules to the versions of a key. The key stays
+// locked, so a version written meanwhile is not expired by a decision
+// made for its predecessor.
+func expireKey(app *S.App, bucket string, key string, rules []S.LifecycleRule, now time.Time) error {
+	unlock := app.Locks.Lock(bucket, key)
+	defer unlock()
+
+	idx, err := readObjectIndex(app, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	// noncurrent versions first, versions are ordered newest first and each
+	// became noncurrent when its successor was created
+	expired := []string{}
+	newer := 0
+	for i := 1; i < len(idx.Versions); i++ {
+		v := idx.Versions[i]
+		since := idx.Versions[i-1].LastModified
+		for _, rule := range rules {
+			if rule.Matches(key, v.Tags, v.Size) && rule.NoncurrentExpired(since, newer, now) {
+				expired = append(expired, v.VersionID)
+				break
+			}
+		}
+		newer++
+	}
+	for _, versionID := range expired {
+		if _, err := deleteLockedVersion(app, bucket, key, versionID, false); err != nil {
+			if !errors.Is(err, errObjectLocked) {
+				return err
+			}
+		} else {
+			log.Printf("lifecycle: expired noncurrent version %s of %s/%s", versionID, bucket, key)
+		}
+	}
+
+	idx, err = readObjectIndex(app, bucket, key)
+	if err != nil {
+		return err
+	}
+	latest := idx.Latest()
+	if latest == nil {
+		return nil
+	}
+
+	for _, rule := range rules {
+		if !rule.Matches(key, latest.Tags, latest.Size) || rule.Expiration == nil {
+			continue
+		}
+
+		if latest.DeleteMarker {
+			// a delete marker without noncurrent versions is expired
+			if rule.Expiration.ExpiredObjectDeleteMarker && len(idx.Versions) == 1 {
+				log.Printf("lifecycle: removing expired delete marker of %s/%s", bucket, key)
+				_, err := deleteLockedVersion(app, bucket, key, latest.VersionID, false)
+				return err
+			}
+			continue
+		}
+
+		if rule.Expired(latest.LastModified, now) {
+			log.Printf("lifecycle: expiring %s/%s", bucket, key)
+			_, err := deleteLockedVersion(app, bucket, key, "", false)
+			if errors.Is(err, errObjectLocked) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+func readObjectIndex(app *S.App, bucket string, key string) (*S.ObjectIndex, error) {
+	idx, err := app.Backend.ReadObjectIndex(bucket, key)
+	if err == nil {
+		return idx, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// objects written before metadata existed or copied into the mount directly
+	idx = &S.ObjectIndex{Key: key}
+	stat, err := app.Backend.StatObject(bucket, key)
+	if err == nil && !stat.IsDir {
+		idx.Versions = []S.ObjectMeta{{
+			VersionID:    "null",
+			ETag:         fmt.Sprintf("\"%x\"", sha256.Sum224([]byte(fmt.Sprint(key, stat.Size, stat.ModTime.UnixNano())))),
+			Size:         stat.Size,
+			LastModified: stat.ModTime,
+		}}
+	}
+	return idx, nil
+}
+
+func bucketConfigName(bucket string, name string) string {
+	return "buckets/" + bucket + "/" + name + ".xml"
+}
+
+// readBucketConfig unmarshals a bucket configuration into v and reports
+// whether it exists.
+func readBucketConfig(app *S.App, bucket string, name string, v any) (bool, error) {
+	b, err := app.Backend.ReadMetadata(bucketConfigName(bucket, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, xml.Unmarshal(b, v)
+}
+
+func writeBucketConfig(app *S.App, bucket string, name string, v any) error {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return app.Backend.WriteMetadata(bucketConfigName(bucket, name), b)
+}
+
+func deleteBucketConfig(app *S.App, bucket string, name string) error {
+	return app.Backend.DeleteMetadata(bucketConfigName(bucket, name))
+}
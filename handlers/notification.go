@@ -0,0 +1,232 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+var notificationClient = &http.Client{Timeout: 10 * time.Second}
+
+type notification struct {
+	Target      string
+	Event       S.Event
+	Attempts    int
+	NextAttempt time.Time
+}
+
+func GetBucketNotificationConfiguration(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#GetBucketNotificationConfiguration: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	// buckets without notifications have an empty configuration
+	var config S.NotificationConfiguration
+	if _, err := readBucketConfig(app, r.Bucket, "notification", &config); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.RespondXML(w, http.StatusOK, config)
+}
+
+func PutBucketNotificationConfiguration(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutBucketNotificationConfiguration: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var config S.NotificationConfiguration
+	if err := decodeXMLBody(req, &config); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Bucket)
+	}
+	if err := config.Validate(app.Webhooks); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, r.Bucket)
+	}
+
+	if len(config.QueueConfigurations) == 0 {
+		if err := deleteBucketConfig(app, r.Bucket, "notification"); err != nil {
+			return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+		}
+		return app.Respond(w, http.StatusOK, nil, nil)
+	}
+
+	if err := writeBucketConfig(app, r.Bucket, "notification", config); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusOK, nil, nil)
+}
+
+// notify publishes event on a version of key to the live subscribers and
+// queues it for every matching notification configuration of the bucket.
+// meta is nil for events without object data.
+func notify(app *S.App, req *http.Request, event string, bucket string, key string, meta *S.ObjectMeta) {
+	if len(app.Webhooks) == 0 && !app.Events.Listening(bucket) {
+		return
+	}
+
+	principal := *app.AccessKey
+	if c := S.RequestCredentials(req); c != nil {
+		principal = c.AccessKey
+	}
+	sourceIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		sourceIP = req.RemoteAddr
+	}
+
+	now := time.Now()
+	app.Events.Publish(bucket, event, key, S.NewEventRecord(event, bucket, key, meta, principal, sourceIP, now))
+
+	if len(app.Webhooks) == 0 {
+		return
+	}
+	var config S.NotificationConfiguration
+	found, err := readBucketConfig(app, bucket, "notification", &config)
+	if err != nil {
+		log.Printf("can not read notification configuration of %s: %v", bucket, err)
+		return
+	}
+	if !found {
+		return
+	}
+
+	queued := false
+	for _, q := range config.QueueConfigurations {
+		if !q.Matches(event, key) {
+			continue
+		}
+		if _, ok := app.Webhooks[q.Queue]; !ok {
+			log.Printf("notification target %s of %s no longer exists", q.Queue, bucket)
+			continue
+		}
+
+		record := S.NewEventRecord(event, bucket, key, meta, principal, sourceIP, now)
+		record.S3.ConfigurationId = q.Id
+		n := notification{Target: q.Queue, Event: S.Event{Records: []S.EventRecord{record}}, NextAttempt: now}
+		if err := queueEntry(app, "notifications", now, &n); err != nil {
+			log.Printf("can not queue %s of %s/%s: %v", event, bucket, key, err)
+			continue
+		}
+		queued = true
+	}
+
+	if queued {
+		wake(app.NotificationWake)
+	}
+}
+
+// notifyDeleted queues the removal event of a deleted version or created delete marker.
+func notifyDeleted(app *S.App, req *http.Request, bucket string, deleted S.DeletedObject) {
+	if deleted.DeleteMarker && len(deleted.DeleteMarkerVersionID) > 0 {
+		notify(app, req, "s3:ObjectRemoved:DeleteMarkerCreated", bucket, deleted.Key, &S.ObjectMeta{VersionID: deleted.DeleteMarkerVersionID})
+		return
+	}
+	notify(app, req, "s3:ObjectRemoved:Delete", bucket, deleted.Key, &S.ObjectMeta{VersionID: deleted.VersionID})
+}
+
+func NotificationWorker(ctx context.Context, app *S.App, interval time.Duration) {
+	for {
+		DeliverNotifications(app, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-app.NotificationWake:
+		case <-time.After(interval):
+		}
+	}
+}
+
+// DeliverNotifications posts the queued events which are due in order.
+// After a failed delivery later events of the same target wait as well.
+func DeliverNotifications(app *S.App, now time.Time) {
+	names, err := queueEntries(app, "notifications")
+	if err != nil {
+		log.Printf("can not read notification queue: %v", err)
+		return
+	}
+
+	blocked := make(map[string]bool)
+	for _, name := range names {
+		b, err := app.Backend.ReadMetadata("notifications/" + name)
+		if err != nil {
+			log.Printf("can not read notification %s: %v", name, err)
+			continue
+		}
+		var n notification
+		if err := json.Unmarshal(b, &n); err != nil {
+			log.Printf("dropping corrupt notification %s: %v", name, err)
+			app.Backend.DeleteMetadata("notifications/" + name)
+			continue
+		}
+		if blocked[n.Target] {
+			continue
+		}
+		if now.Before(n.NextAttempt) {
+			blocked[n.Target] = true
+			continue
+		}
+
+		target, ok := app.Webhooks[n.Target]
+		if !ok {
+			log.Printf("dropping notification %s for unknown target %s", name, n.Target)
+			app.Backend.DeleteMetadata("notifications/" + name)
+			continue
+		}
+
+		if err := postNotification(target, &n.Event); err != nil {
+			n.Attempts++
+			n.NextAttempt = now.Add(retryBackoff(n.Attempts))
+			log.Printf("notification %s to %s failed %d times, retry at %v: %v", name, target.Name, n.Attempts, n.NextAttempt, err)
+			if err := writeQueueEntry(app, "notifications", name, &n); err != nil {
+				log.Printf("can not update notification %s: %v", name, err)
+			}
+			blocked[n.Target] = true
+			continue
+		}
+
+		if err := app.Backend.DeleteMetadata("notifications/" + name); err != nil {
+			log.Printf("can not remove delivered notification %s: %v", name, err)
+		}
+	}
+}
+
+func postNotification(target *S.WebhookTarget, event *S.Event) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target.Endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(target.AuthToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+target.AuthToken)
+	}
+
+	res, err := notificationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", res.Status)
+	}
+	return nil
+}
@@ -8,12 +8,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/url"
-	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	S "github.com/autovia/s3-go/structs"
 )
@@ -24,11 +28,7 @@ const RFC822Format = "Mon, 2 Jan 2006 15:04:05 GMT"
 func ListObjectsV2(app *S.App, w http.ResponseWriter, r *S.Request) error {
 	log.Printf("#ListObjectsV2 %v\n", r)
 
-	if _, err := os.Stat(r.Path); os.IsNotExist(err) {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
-	}
-
-	contents, err := os.ReadDir(r.Path)
+	contents, err := app.Backend.ListDir(r.Bucket, r.Key)
 	if err != nil {
 		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
 	}
@@ -36,17 +36,15 @@ func ListObjectsV2(app *S.App, w http.ResponseWriter, r *S.Request) error {
 	objects := []S.Object{}
 	prefixes := []S.CommonPrefix{}
 	for _, file := range contents {
-		fileInfo, _ := file.Info()
-		if !file.IsDir() {
-			t := fileInfo.ModTime()
+		if !file.IsDir {
 			objects = append(objects, S.Object{
-				Key:          fileInfo.Name(),
-				LastModified: t.Format(RFC822Format),
-				Size:         fileInfo.Size(),
-				ETag:         fileInfo.Name(),
+				Key:          file.Name,
+				LastModified: file.ModTime.Format(RFC822Format),
+				Size:         file.Size,
+				ETag:         file.Name,
 				StorageClass: "STANDARD"})
 		} else {
-			prefixes = append(prefixes, S.CommonPrefix{Prefix: fileInfo.Name() + "/"})
+			prefixes = append(prefixes, S.CommonPrefix{Prefix: file.Name + "/"})
 		}
 	}
 
@@ -65,73 +63,136 @@ func ListObjectsV2(app *S.App, w http.ResponseWriter, r *S.Request) error {
 func CopyObject(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
 	log.Printf("#CopyObject: %v\n", r)
 
-	source := req.Header.Get("X-Amz-Copy-Source")
-	sourcePath, err := url.QueryUnescape(source)
+	source, versionID, _ := strings.Cut(req.Header.Get("X-Amz-Copy-Source"), "?versionId=")
+	sourcePath, err := url.PathUnescape(source)
 	if err != nil {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, r.Key)
 	}
 
-	sourceFile, err := os.Open(*app.Mount + sourcePath)
+	sourceBucket, sourceKey, _ := strings.Cut(strings.TrimPrefix(sourcePath, "/"), "/")
+	if err := S.ValidateKey(sourceKey); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, r.Key)
+	}
+	action := "s3:GetObject"
+	if len(versionID) > 0 {
+		action = "s3:GetObjectVersion"
+	}
+	if !objectAllowed(req, action, sourceBucket, sourceKey) {
+		return app.RespondError(w, http.StatusForbidden, "AccessDenied", errors.New("AccessDenied"), source)
+	}
+	directive := req.Header.Get("X-Amz-Metadata-Directive")
+	if sourceBucket == r.Bucket && sourceKey == r.Key && len(versionID) == 0 && directive != "REPLACE" {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", errors.New("copy to itself without changing metadata"), r.Key)
+	}
+
+	sourceCustomerKey, err := customerKey(req, S.SSECopySourceCustomerPrefix)
 	if err != nil {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", err, r.Key)
+	}
+	targetCustomerKey, err := customerKey(req, S.SSECustomerPrefix)
+	if err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", err, r.Key)
+	}
+
+	// the open source stays readable when it is written meanwhile
+	unlock := app.Locks.RLock(sourceBucket, sourceKey)
+	idx, i, err := lookupVersion(app, sourceBucket, sourceKey, versionID)
+	if err != nil || idx.Versions[i].DeleteMarker {
+		unlock()
+		return respondNoSuchVersion(app, w, &S.Request{Bucket: sourceBucket, Key: sourceKey, VersionID: versionID}, idx, i, err)
+	}
+	sourceMeta := idx.Versions[i]
+	sourceFile, err := openObjectData(app, sourceBucket, idx, i, 0, sourceCustomerKey)
+	unlock()
+	if err != nil {
+		return respondObjectError(app, w, r, err)
 	}
 	defer sourceFile.Close()
 
-	if _, err := os.Stat(filepath.Dir(r.Path)); os.IsNotExist(err) {
-		err := os.MkdirAll(filepath.Dir(r.Path), os.ModePerm)
+	meta := S.ObjectMeta{ContentType: sourceMeta.ContentType, UserMetadata: sourceMeta.UserMetadata, WebsiteRedirectLocation: sourceMeta.WebsiteRedirectLocation}
+	if directive == "REPLACE" {
+		redirect, err := websiteRedirectLocation(req.Header)
 		if err != nil {
-			return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+			return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, r.Key)
 		}
+		meta = S.ObjectMeta{ContentType: req.Header.Get("Content-Type"), UserMetadata: userMetadata(req.Header), WebsiteRedirectLocation: redirect}
+	}
+	meta.Tags = sourceMeta.Tags
+	if req.Header.Get("X-Amz-Tagging-Directive") == "REPLACE" {
+		meta.Tags, err = S.ParseTaggingHeader(req.Header.Get("X-Amz-Tagging"), S.MaxObjectTags)
+		if err != nil {
+			return app.RespondError(w, http.StatusBadRequest, "InvalidTag", err, r.Key)
+		}
+	}
+	if err := applyObjectLock(app, r.Bucket, req.Header, &meta); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", err, r.Key)
+	}
+	if err := applyEncryption(app, r.Bucket, r.Key, req.Header, &meta, targetCustomerKey); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, r.Key)
 	}
 
-	targetFile, err := os.Create(r.Path)
+	meta, err = putObjectData(app, r.Bucket, r.Key, sourceFile, meta, targetCustomerKey, governanceBypass(req, r.Bucket, r.Key))
 	if err != nil {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+		return respondObjectError(app, w, r, err)
 	}
-	defer targetFile.Close()
-	io.Copy(targetFile, sourceFile)
+	notify(app, req, "s3:ObjectCreated:Copy", r.Bucket, r.Key, &meta)
+	replicate(app, r.Bucket, r.Key, &meta)
 
-	stats, err := os.Stat(r.Path)
-	if err != nil {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+	if len(bucketVersioning(app, sourceBucket)) > 0 {
+		w.Header().Set("X-Amz-Copy-Source-Version-Id", sourceMeta.VersionID)
+	}
+	if len(bucketVersioning(app, r.Bucket)) > 0 {
+		w.Header().Set("X-Amz-Version-Id", meta.VersionID)
+	}
+	headers := make(map[string]string)
+	encryptionHeaders(&meta, headers)
+	if len(meta.SSEContext) > 0 {
+		headers["X-Amz-Server-Side-Encryption-Context"] = meta.SSEContext
+	}
+	customerKeyHeaders(req, headers)
+	for k, v := range headers {
+		w.Header().Set(k, v)
 	}
-	t := stats.ModTime()
 	return app.RespondXML(w, http.StatusOK, S.CopyObjectResponse{
-		LastModified: t.Format(ISO8601UTCFormat),
-		ETag:         "123",
+		LastModified: meta.LastModified.Format(ISO8601UTCFormat),
+		ETag:         meta.ETag,
 	})
 }
 
-func CreateMultipartUpload(app *S.App, w http.ResponseWriter, r *S.Request) error {
+func CreateMultipartUpload(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
 	log.Printf("#CreateMultipartUpload: %v\n", r)
 
-	if _, err := os.Stat(r.Path); !os.IsNotExist(err) {
+	if _, err := app.Backend.StatObject(r.Bucket, r.Key); !errors.Is(err, fs.ErrNotExist) {
 		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
 	}
 
-	if strings.HasSuffix(r.Path, "/") {
+	if strings.HasSuffix(r.Key, "/") {
 		return app.RespondError(w, http.StatusInternalServerError, "InternalError", errors.New("path is a directory"), r.Key)
 	}
 
-	uploadID := generate(50)
-	metapath := filepath.Join(*app.Mount, *app.Metadata, uploadID)
-	if err := os.MkdirAll(metapath, os.ModePerm); err != nil {
+	// parts are not checked against the quota, so uploads which could
+	// exceed it are not started
+	var quota S.BucketQuota
+	if found, err := readBucketConfig(app, r.Bucket, "quota", &quota); err != nil {
 		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+	} else if found {
+		return app.RespondError(w, http.StatusNotImplemented, "NotImplemented", errors.New("multipart uploads into buckets with a quota are not supported"), r.Key)
 	}
 
-	newfile := filepath.Join(metapath, r.Key)
-	if _, err := os.Stat(filepath.Dir(newfile)); os.IsNotExist(err) {
-		err := os.MkdirAll(filepath.Dir(newfile), os.ModePerm)
-		if err != nil {
-			return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
-		}
+	tags, err := S.ParseTaggingHeader(req.Header.Get("X-Amz-Tagging"), S.MaxObjectTags)
+	if err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidTag", err, r.Key)
 	}
 
-	f, err := os.Create(newfile)
+	uploadID := generate(50)
+	err = app.Backend.CreateMultipartUpload(uploadID, r.Key, &S.ObjectMeta{
+		ContentType:  req.Header.Get("Content-Type"),
+		UserMetadata: userMetadata(req.Header),
+		Tags:         tags,
+	})
 	if err != nil {
 		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
 	}
-	defer f.Close()
 
 	return app.RespondXML(w, http.StatusOK, S.InitiateMultipartUploadResponse{
 		Bucket:   r.Bucket,
@@ -143,134 +204,276 @@ func CreateMultipartUpload(app *S.App, w http.ResponseWriter, r *S.Request) erro
 func PutObject(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
 	log.Printf("#PutObject: %v\n", r)
 
-	if _, err := os.Stat(r.Path); !os.IsNotExist(err) {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
-	}
-
-	if strings.HasSuffix(r.Path, "/") {
-		err := os.MkdirAll(r.Path, os.ModePerm)
-		if err != nil {
+	if strings.HasSuffix(r.Key, "/") {
+		if err := app.Backend.MakeDir(r.Bucket, r.Key); err != nil {
 			return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
 		}
 		return app.Respond(w, http.StatusOK, nil, nil)
 	}
 
-	if _, err := os.Stat(filepath.Dir(r.Path)); os.IsNotExist(err) {
-		err := os.MkdirAll(filepath.Dir(r.Path), os.ModePerm)
-		if err != nil {
-			return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
-		}
+	tags, err := S.ParseTaggingHeader(req.Header.Get("X-Amz-Tagging"), S.MaxObjectTags)
+	if err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidTag", err, r.Key)
 	}
 
-	targetFile, err := os.Create(r.Path)
+	redirect, err := websiteRedirectLocation(req.Header)
 	if err != nil {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, r.Key)
+	}
+
+	meta := S.ObjectMeta{
+		ContentType:             req.Header.Get("Content-Type"),
+		UserMetadata:            userMetadata(req.Header),
+		Tags:                    tags,
+		WebsiteRedirectLocation: redirect,
+	}
+	if err := applyObjectLock(app, r.Bucket, req.Header, &meta); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", err, r.Key)
+	}
+	sseCustomerKey, err := customerKey(req, S.SSECustomerPrefix)
+	if err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", err, r.Key)
+	}
+	if err := applyEncryption(app, r.Bucket, r.Key, req.Header, &meta, sseCustomerKey); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, r.Key)
 	}
-	defer targetFile.Close()
 
 	defer req.Body.Close()
-	io.Copy(targetFile, req.Body)
+	meta, err = putObjectData(app, r.Bucket, r.Key, req.Body, meta, sseCustomerKey, governanceBypass(req, r.Bucket, r.Key))
+	if err != nil {
+		return respondObjectError(app, w, r, err)
+	}
+	notify(app, req, "s3:ObjectCreated:Put", r.Bucket, r.Key, &meta)
+	replicate(app, r.Bucket, r.Key, &meta)
+
+	headers := make(map[string]string)
+	headers["ETag"] = meta.ETag
+	if len(bucketVersioning(app, r.Bucket)) > 0 {
+		headers["X-Amz-Version-Id"] = meta.VersionID
+	}
+	encryptionHeaders(&meta, headers)
+	if len(meta.SSEContext) > 0 {
+		headers["X-Amz-Server-Side-Encryption-Context"] = meta.SSEContext
+	}
+	customerKeyHeaders(req, headers)
 
-	return app.Respond(w, http.StatusOK, nil, nil)
+	return app.Respond(w, http.StatusOK, headers, nil)
 }
 
-func HeadObject(app *S.App, w http.ResponseWriter, r *S.Request) error {
+func HeadObject(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
 	log.Printf("#HeadObject: %v\n", r)
 
-	if _, err := os.Stat(r.Path); os.IsNotExist(err) {
-		return app.RespondError(w, http.StatusBadRequest, "NoSuchKey", err, r.Key)
+	idx, i, err := lookupVersion(app, r.Bucket, r.Key, r.VersionID)
+	if err != nil || idx.Versions[i].DeleteMarker {
+		return respondNoSuchVersion(app, w, r, idx, i, err)
 	}
 
-	file, err := os.Stat(r.Path)
+	sseCustomerKey, err := customerKey(req, S.SSECustomerPrefix)
 	if err != nil {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", err, r.Key)
+	}
+	if err := checkCustomerKey(&idx.Versions[i], sseCustomerKey); err != nil {
+		return respondObjectError(app, w, r, err)
 	}
 
-	headers := make(map[string]string)
-	t := file.ModTime()
-	headers["Content-Length"] = fmt.Sprintf("%v", file.Size())
-	headers["Last-Modified"] = t.Format(RFC822Format)
-	headers["ETag"] = "xxx"
-	headers["X-Amz-Meta-Autovia"] = "ARCHIVE_ACCESS"
+	headers := objectHeaders(&idx.Versions[i], len(bucketVersioning(app, r.Bucket)) > 0)
+	customerKeyHeaders(req, headers)
 
 	return app.Respond(w, http.StatusOK, headers, nil)
 }
 
-func GetObject(app *S.App, w http.ResponseWriter, r *S.Request) error {
+func GetObject(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
 	log.Printf("#GetObject: %v\n", r)
 
-	if _, err := os.Stat(r.Path); os.IsNotExist(err) {
-		return app.RespondError(w, 400, "NoSuchKey", err, r.Key)
+	sseCustomerKey, err := customerKey(req, S.SSECustomerPrefix)
+	if err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", err, r.Key)
 	}
 
-	file, err := os.Open(r.Path)
-	if err != nil {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+	// the version and its data are read together, the open data stays
+	// readable when the key is written meanwhile
+	unlock := app.Locks.RLock(r.Bucket, r.Key)
+	idx, i, err := lookupVersion(app, r.Bucket, r.Key, r.VersionID)
+	if err != nil || idx.Versions[i].DeleteMarker {
+		unlock()
+		return respondNoSuchVersion(app, w, r, idx, i, err)
 	}
-	stats, err := file.Stat()
+	meta := &idx.Versions[i]
+
+	start, length, partial, err := S.ParseRange(req.Header.Get("Range"), meta.Size)
 	if err != nil {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+		unlock()
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", meta.Size))
+		return app.RespondError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", err, r.Key)
 	}
-	if stats.IsDir() {
-		return app.RespondError(w, 400, "NoSuchKey", err, r.Key)
+
+	file, err := openObjectData(app, r.Bucket, idx, i, start, sseCustomerKey)
+	unlock()
+	if err != nil {
+		return respondObjectError(app, w, r, err)
 	}
 
-	headers := make(map[string]string)
-	t := stats.ModTime()
-	headers["Content-Length"] = fmt.Sprintf("%v", stats.Size())
-	headers["Last-Modified"] = t.Format(RFC822Format)
+	headers := objectHeaders(meta, len(bucketVersioning(app, r.Bucket)) > 0)
+	customerKeyHeaders(req, headers)
+	headers["Accept-Ranges"] = "bytes"
+	headers["Content-Length"] = fmt.Sprintf("%v", length)
+	if partial {
+		headers["Content-Range"] = fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, meta.Size)
+		return app.RespondFile(w, http.StatusPartialContent, headers, readCloser{io.LimitReader(file, length), file})
+	}
 
 	return app.RespondFile(w, http.StatusOK, headers, file)
 }
 
-func ListObjectVersions(app *S.App, w http.ResponseWriter, r *S.Request) error {
-	if _, err := os.Stat(r.Path); os.IsNotExist(err) {
-		return app.RespondError(w, 400, "NoSuchKey", err, r.Key)
+func ListObjectVersions(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#ListObjectVersions: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
 	}
 
-	file, err := os.Open(r.Path)
-	if err != nil {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+	query := req.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	keyMarker := query.Get("key-marker")
+	versionIDMarker := query.Get("version-id-marker")
+
+	maxKeys := 1000
+	if query.Has("max-keys") {
+		n, err := strconv.Atoi(query.Get("max-keys"))
+		if err != nil || n < 0 {
+			return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", errors.New("invalid max-keys"), r.Bucket)
+		}
+		maxKeys = min(n, 1000)
+	}
+	if len(versionIDMarker) > 0 && len(keyMarker) == 0 {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", errors.New("version-id-marker requires key-marker"), r.Bucket)
 	}
-	stats, err := file.Stat()
+
+	keys, err := app.Backend.ListKeys(r.Bucket, prefix)
 	if err != nil {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
 	}
-	t := stats.ModTime()
-	return app.RespondXML(w, http.StatusOK, S.ListVersionsResult{
-		Name:        r.Bucket,
-		Prefix:      r.Key,
-		MaxKeys:     1,
-		IsTruncated: false,
-		Version: []S.ObjectVersion{
-			{
-				Object: S.Object{
-					Key:          r.Key,
-					LastModified: t.Format(ISO8601UTCFormat),
-					ETag:         "xxx",
-					Size:         stats.Size(),
-					StorageClass: "STANDARD",
-					Owner:        &S.Owner{ID: "123", DisplayName: "jan"},
-				},
-				IsLatest:  true,
-				VersionID: "xxx",
-			},
-		},
-	})
+
+	result := S.ListVersionsResult{
+		Name:            r.Bucket,
+		Prefix:          prefix,
+		KeyMarker:       keyMarker,
+		VersionIDMarker: versionIDMarker,
+		MaxKeys:         maxKeys,
+		Delimiter:       delimiter,
+		Version:         []S.ObjectVersion{},
+		DeleteMarker:    []S.DeleteMarkerEntry{},
+	}
+
+	count := 0
+	seenPrefixes := make(map[string]bool)
+	owner := &S.Owner{ID: "123", DisplayName: "jan"}
+	for _, key := range keys {
+		if key < keyMarker || (key == keyMarker && len(versionIDMarker) == 0) {
+			continue
+		}
+
+		if len(delimiter) > 0 {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				commonPrefix := key[:len(prefix)+i+len(delimiter)]
+				if seenPrefixes[commonPrefix] || commonPrefix <= keyMarker && strings.HasPrefix(keyMarker, commonPrefix) {
+					continue
+				}
+				if count == maxKeys {
+					result.IsTruncated = true
+					break
+				}
+				seenPrefixes[commonPrefix] = true
+				result.CommonPrefixes = append(result.CommonPrefixes, S.CommonPrefix{Prefix: commonPrefix})
+				result.NextKeyMarker = commonPrefix
+				result.NextVersionIDMarker = ""
+				count++
+				continue
+			}
+		}
+
+		idx, err := readObjectIndex(app, r.Bucket, key)
+		if err != nil {
+			return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+		}
+
+		versions := idx.Versions
+		if key == keyMarker {
+			// continue after the version of the previous page
+			i := idx.Find(versionIDMarker)
+			if i < 0 {
+				continue
+			}
+			versions = versions[i+1:]
+		}
+
+		for _, v := range versions {
+			if count == maxKeys {
+				result.IsTruncated = true
+				break
+			}
+			isLatest := v.VersionID == idx.Versions[0].VersionID
+			if v.DeleteMarker {
+				result.DeleteMarker = append(result.DeleteMarker, S.DeleteMarkerEntry{
+					Key:          key,
+					VersionID:    v.VersionID,
+					IsLatest:     isLatest,
+					LastModified: v.LastModified.Format(ISO8601UTCFormat),
+					Owner:        owner,
+				})
+			} else {
+				result.Version = append(result.Version, S.ObjectVersion{
+					Object: S.Object{
+						Key:          key,
+						LastModified: v.LastModified.Format(ISO8601UTCFormat),
+						ETag:         v.ETag,
+						Size:         v.Size,
+						StorageClass: "STANDARD",
+						Owner:        owner,
+					},
+					IsLatest:  isLatest,
+					VersionID: v.VersionID,
+				})
+			}
+			result.NextKeyMarker = key
+			result.NextVersionIDMarker = v.VersionID
+			count++
+		}
+		if result.IsTruncated {
+			break
+		}
+	}
+
+	if !result.IsTruncated {
+		result.NextKeyMarker = ""
+		result.NextVersionIDMarker = ""
+	}
+
+	return app.RespondXML(w, http.StatusOK, result)
 }
 
-func DeleteObject(app *S.App, w http.ResponseWriter, r *S.Request) error {
+func DeleteObject(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
 	log.Printf("#DeleteObject: %v\n", r)
 
-	if _, err := os.Stat(r.Path); os.IsNotExist(err) {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
 	}
 
-	if err := os.RemoveAll(r.Path); err != nil {
-		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+	deleted, err := deleteObjectVersion(app, r.Bucket, r.Key, r.VersionID, governanceBypass(req, r.Bucket, r.Key))
+	if err != nil {
+		return respondObjectError(app, w, r, err)
 	}
+	notifyDeleted(app, req, r.Bucket, deleted)
+	replicateDeleted(app, r.Bucket, deleted)
 	headers := make(map[string]string)
 	headers["Content-Length"] = "0"
+	if deleted.DeleteMarker {
+		headers["X-Amz-Delete-Marker"] = "true"
+		headers["X-Amz-Version-Id"] = deleted.DeleteMarkerVersionID
+	} else if len(deleted.VersionID) > 0 {
+		headers["X-Amz-Version-Id"] = deleted.VersionID
+	}
 
 	return app.Respond(w, http.StatusOK, headers, nil)
 }
@@ -288,31 +491,38 @@ func DeleteObjects(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Re
 	objects := []S.DeletedObject{}
 	errors := []S.DeleteError{}
 	for _, file := range delete.Objects {
-		path := filepath.Join(*app.Mount, r.Bucket, file.Key)
-		delErr := S.DeleteError{}
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			delErr = S.DeleteError{
-				Code:    "NoSuchKey",
-				Message: "NoSuchKey",
-				Key:     file.Key,
-			}
+		action := "s3:DeleteObject"
+		if len(file.VersionID) > 0 {
+			action = "s3:DeleteObjectVersion"
 		}
-
-		if err := os.RemoveAll(path); err != nil {
-			delErr = S.DeleteError{
-				Code:    "NoSuchKey",
-				Message: "NoSuchKey",
-				Key:     file.Key,
-			}
+		if !objectAllowed(req, action, r.Bucket, file.Key) {
+			errors = append(errors, S.DeleteError{
+				Code:      "AccessDenied",
+				Message:   "AccessDenied",
+				Key:       file.Key,
+				VersionID: file.VersionID,
+			})
+			continue
 		}
-
-		if delErr != (S.DeleteError{}) {
-			errors = append(errors, delErr)
+		deleted, err := deleteObjectVersion(app, r.Bucket, file.Key, file.VersionID, governanceBypass(req, r.Bucket, file.Key))
+		if err != nil {
+			log.Printf("can not delete %s: %v", file.Key, err)
+			code := "InternalError"
+			if err == errObjectLocked {
+				code = "AccessDenied"
+			}
+			errors = append(errors, S.DeleteError{
+				Code:      code,
+				Message:   code,
+				Key:       file.Key,
+				VersionID: file.VersionID,
+			})
 		} else {
-			obj := S.DeletedObject{
-				Key: file.Key,
+			notifyDeleted(app, req, r.Bucket, deleted)
+			replicateDeleted(app, r.Bucket, deleted)
+			if !delete.Quiet {
+				objects = append(objects, deleted)
 			}
-			objects = append(objects, obj)
 		}
 	}
 
@@ -323,3 +533,142 @@ func DeleteObjects(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Re
 		Errors:         errors,
 	})
 }
+
+func PostObject(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PostObject: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedPOSTRequest", err, r.Bucket)
+	}
+	defer req.Body.Close()
+
+	// form fields must precede the file field
+	fields := map[string]string{"bucket": r.Bucket}
+	var file *multipart.Part
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return app.RespondError(w, http.StatusBadRequest, "MalformedPOSTRequest", err, r.Bucket)
+		}
+		name := strings.ToLower(part.FormName())
+		if name == "file" {
+			file = part
+			break
+		}
+		value, err := io.ReadAll(io.LimitReader(part, 20*1024))
+		if err != nil {
+			return app.RespondError(w, http.StatusBadRequest, "MalformedPOSTRequest", err, r.Bucket)
+		}
+		fields[name] = string(value)
+	}
+
+	if file == nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", errors.New("POST requires exactly one file upload per request"), r.Bucket)
+	}
+	if len(fields["key"]) == 0 {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", errors.New("bucket POST must contain a field named 'key'"), r.Bucket)
+	}
+
+	credentials, ok := app.ValidPostPolicySignature(fields)
+	if !ok {
+		return app.RespondError(w, http.StatusForbidden, "SignatureDoesNotMatch", errors.New("SignatureDoesNotMatch"), r.Bucket)
+	}
+
+	policy, err := S.ParsePostPolicy(fields["policy"])
+	if err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidPolicyDocument", err, r.Bucket)
+	}
+	if err := policy.Check(fields, time.Now()); err != nil {
+		return app.RespondError(w, http.StatusForbidden, "AccessDenied", err, r.Bucket)
+	}
+
+	key := strings.ReplaceAll(fields["key"], "${filename}", filepath.Base(file.FileName()))
+	if strings.HasSuffix(key, "/") || !strings.HasPrefix(path.Join(r.Bucket, key), r.Bucket+"/") {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", errors.New("invalid key"), key)
+	}
+	if err := S.ValidateKey(key); errors.Is(err, S.ErrKeyTooLong) {
+		return app.RespondError(w, http.StatusBadRequest, "KeyTooLongError", err, key)
+	} else if err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, key)
+	}
+
+	if !credentials.IsAllowed("s3:PutObject", "arn:aws:s3:::"+r.Bucket+"/"+key) {
+		return app.RespondError(w, http.StatusForbidden, "AccessDenied", errors.New("AccessDenied"), key)
+	}
+
+	// an upload out of range is discarded before it replaces the key
+	body := policy.ContentLengthReader(file)
+
+	meta := S.ObjectMeta{ContentType: fields["content-type"], UserMetadata: make(map[string]string)}
+	for k, v := range fields {
+		if strings.HasPrefix(k, "x-amz-meta-") {
+			meta.UserMetadata[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+
+	if err := applyObjectLock(app, r.Bucket, http.Header{}, &meta); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", err, key)
+	}
+	encryption := http.Header{}
+	for _, field := range []string{"x-amz-server-side-encryption", "x-amz-server-side-encryption-aws-kms-key-id", "x-amz-server-side-encryption-context"} {
+		if v := fields[field]; len(v) > 0 {
+			encryption.Set(field, v)
+		}
+	}
+	if err := applyEncryption(app, r.Bucket, key, encryption, &meta, nil); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, key)
+	}
+
+	meta, err = putObjectData(app, r.Bucket, key, body, meta, nil, governanceBypass(req, r.Bucket, key))
+	if err != nil {
+		return respondObjectError(app, w, &S.Request{Bucket: r.Bucket, Key: key}, err)
+	}
+
+	notify(app, req, "s3:ObjectCreated:Post", r.Bucket, key, &meta)
+	replicate(app, r.Bucket, key, &meta)
+
+	etag := meta.ETag
+	location := fmt.Sprintf("/%s/%s", r.Bucket, key)
+
+	if redirect := fields["success_action_redirect"]; len(redirect) > 0 {
+		if u, err := url.Parse(redirect); err == nil {
+			query := u.Query()
+			query.Set("bucket", r.Bucket)
+			query.Set("key", key)
+			query.Set("etag", etag)
+			u.RawQuery = query.Encode()
+			return app.Respond(w, http.StatusSeeOther, map[string]string{"Location": u.String(), "ETag": etag}, nil)
+		}
+	}
+
+	headers := make(map[string]string)
+	headers["ETag"] = etag
+	headers["Location"] = location
+	if len(bucketVersioning(app, r.Bucket)) > 0 {
+		headers["X-Amz-Version-Id"] = meta.VersionID
+	}
+
+	switch fields["success_action_status"] {
+	case "200":
+		return app.Respond(w, http.StatusOK, headers, nil)
+	case "201":
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Location", location)
+		return app.RespondXML(w, http.StatusCreated, S.PostResponse{
+			Location: location,
+			Bucket:   r.Bucket,
+			Key:      key,
+			ETag:     etag,
+		})
+	default:
+		return app.Respond(w, http.StatusNoContent, headers, nil)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+// objectLockEnabled reports whether a bucket has object lock enabled.
+func objectLockEnabled(app *S.App, bucket string) (*S.ObjectLockConfiguration, bool) {
+	var config S.ObjectLockConfiguration
+	found, err := readBucketConfig(app, bucket, "object-lock", &config)
+	if err != nil {
+		log.Printf("can not read object lock configuration of %s: %v", bucket, err)
+	}
+	return &config, found && config.ObjectLockEnabled == "Enabled"
+}
+
+// applyObjectLock sets the object lock of a new version from the
+// x-amz-object-lock-* headers or the default retention of the bucket.
+func applyObjectLock(app *S.App, bucket string, header http.Header, meta *S.ObjectMeta) error {
+	mode := header.Get("X-Amz-Object-Lock-Mode")
+	until := header.Get("X-Amz-Object-Lock-Retain-Until-Date")
+	legalHold := header.Get("X-Amz-Object-Lock-Legal-Hold")
+
+	config, enabled := objectLockEnabled(app, bucket)
+	if !enabled {
+		if len(mode) > 0 || len(until) > 0 || len(legalHold) > 0 {
+			return errors.New("bucket is missing object lock configuration")
+		}
+		return nil
+	}
+
+	if (len(mode) > 0) != (len(until) > 0) {
+		return errors.New("x-amz-object-lock-mode and x-amz-object-lock-retain-until-date must be used together")
+	}
+
+	if len(mode) > 0 {
+		retainUntil, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return errors.New("invalid x-amz-object-lock-retain-until-date")
+		}
+		if mode != "GOVERNANCE" && mode != "COMPLIANCE" {
+			return errors.New("invalid x-amz-object-lock-mode")
+		}
+		if !retainUntil.After(time.Now()) {
+			return errors.New("retain until date must be in the future")
+		}
+		meta.LockMode = mode
+		meta.RetainUntil = retainUntil.UTC()
+	} else if config.Rule != nil {
+		retention := config.Rule.DefaultRetention
+		meta.LockMode = retention.Mode
+		meta.RetainUntil = time.Now().UTC().AddDate(retention.Years, 0, retention.Days)
+	}
+
+	switch legalHold {
+	case "", "OFF":
+	case "ON":
+		meta.LegalHold = true
+	default:
+		return errors.New("invalid x-amz-object-lock-legal-hold")
+	}
+	return nil
+}
+
+// lockHeaders returns the object lock response headers of a version.
+func lockHeaders(meta *S.ObjectMeta, headers map[string]string) {
+	if len(meta.LockMode) > 0 {
+		headers["X-Amz-Object-Lock-Mode"] = meta.LockMode
+		headers["X-Amz-Object-Lock-Retain-Until-Date"] = meta.RetainUntil.Format(time.RFC3339)
+	}
+	if meta.LegalHold {
+		headers["X-Amz-Object-Lock-Legal-Hold"] = "ON"
+	}
+}
+
+// governanceBypass reports whether the request may bypass governance mode retention.
+func governanceBypass(req *http.Request, bucket string, key string) bool {
+	if !strings.EqualFold(req.Header.Get("X-Amz-Bypass-Governance-Retention"), "true") {
+		return false
+	}
+	return objectAllowed(req, "s3:BypassGovernanceRetention", bucket, key)
+}
+
+// objectAllowed reports whether the session policies of the request allow
+// action on a key other than the one in the request path.
+func objectAllowed(req *http.Request, action string, bucket string, key string) bool {
+	c := S.RequestCredentials(req)
+	return c == nil || c.IsAllowed(action, "arn:aws:s3:::"+bucket+"/"+key)
+}
+
+func GetObjectLockConfiguration(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#GetObjectLockConfiguration: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	config, enabled := objectLockEnabled(app, r.Bucket)
+	if !enabled {
+		return app.RespondError(w, http.StatusNotFound, "ObjectLockConfigurationNotFoundError", errors.New("object lock configuration does not exist"), r.Bucket)
+	}
+
+	return app.RespondXML(w, http.StatusOK, config)
+}
+
+func PutObjectLockConfiguration(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutObjectLockConfiguration: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var config S.ObjectLockConfiguration
+	if err := decodeXMLBody(req, &config); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Bucket)
+	}
+	if config.ObjectLockEnabled != "Enabled" {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", errors.New("ObjectLockEnabled must be Enabled"), r.Bucket)
+	}
+	if config.Rule != nil {
+		retention := config.Rule.DefaultRetention
+		if retention.Mode != "GOVERNANCE" && retention.Mode != "COMPLIANCE" {
+			return app.RespondError(w, http.StatusBadRequest, "MalformedXML", errors.New("invalid retention mode"), r.Bucket)
+		}
+		if (retention.Days > 0) == (retention.Years > 0) || retention.Days < 0 || retention.Years < 0 {
+			return app.RespondError(w, http.StatusBadRequest, "InvalidRetentionPeriod", errors.New("either days or years must be set"), r.Bucket)
+		}
+	}
+
+	if bucketVersioning(app, r.Bucket) != "Enabled" {
+		return app.RespondError(w, http.StatusConflict, "InvalidBucketState", errors.New("versioning must be enabled"), r.Bucket)
+	}
+
+	if err := writeBucketConfig(app, r.Bucket, "object-lock", config); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusOK, nil, nil)
+}
+
+func GetObjectRetention(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#GetObjectRetention: %v\n", r)
+
+	idx, i, err := lookupVersion(app, r.Bucket, r.Key, r.VersionID)
+	if err != nil || idx.Versions[i].DeleteMarker {
+		return respondNoSuchVersion(app, w, r, idx, i, err)
+	}
+
+	meta := idx.Versions[i]
+	if len(meta.LockMode) == 0 {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchObjectLockConfiguration", errors.New("object has no retention"), r.Key)
+	}
+
+	return app.RespondXML(w, http.StatusOK, S.Retention{
+		Mode:            meta.LockMode,
+		RetainUntilDate: meta.RetainUntil.Format(time.RFC3339),
+	})
+}
+
+func PutObjectRetention(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutObjectRetention: %v\n", r)
+
+	if _, enabled := objectLockEnabled(app, r.Bucket); !enabled {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", errors.New("bucket is missing object lock configuration"), r.Bucket)
+	}
+
+	var retention S.Retention
+	if err := decodeXMLBody(req, &retention); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Key)
+	}
+
+	var until time.Time
+	if len(retention.Mode) > 0 {
+		if retention.Mode != "GOVERNANCE" && retention.Mode != "COMPLIANCE" {
+			return app.RespondError(w, http.StatusBadRequest, "MalformedXML", errors.New("invalid retention mode"), r.Key)
+		}
+		var err error
+		until, err = time.Parse(time.RFC3339, retention.RetainUntilDate)
+		if err != nil || !until.After(time.Now()) {
+			return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", errors.New("invalid retain until date"), r.Key)
+		}
+	}
+
+	bypass := governanceBypass(req, r.Bucket, r.Key)
+	err := updateObjectMeta(app, r.Bucket, r.Key, r.VersionID, func(meta *S.ObjectMeta) error {
+		if time.Now().Before(meta.RetainUntil) {
+			// compliance can only be extended, governance needs a bypass to be weakened
+			weakened := retention.Mode != meta.LockMode || until.Before(meta.RetainUntil)
+			if weakened && (meta.LockMode == "COMPLIANCE" || !bypass) {
+				return errObjectLocked
+			}
+		}
+		meta.LockMode = retention.Mode
+		meta.RetainUntil = until.UTC()
+		return nil
+	})
+	if err != nil {
+		return respondObjectError(app, w, r, err)
+	}
+
+	return app.Respond(w, http.StatusOK, nil, nil)
+}
+
+func GetObjectLegalHold(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#GetObjectLegalHold: %v\n", r)
+
+	idx, i, err := lookupVersion(app, r.Bucket, r.Key, r.VersionID)
+	if err != nil || idx.Versions[i].DeleteMarker {
+		return respondNoSuchVersion(app, w, r, idx, i, err)
+	}
+
+	if _, enabled := objectLockEnabled(app, r.Bucket); !enabled {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", errors.New("bucket is missing object lock configuration"), r.Bucket)
+	}
+
+	status := "OFF"
+	if idx.Versions[i].LegalHold {
+		status = "ON"
+	}
+	return app.RespondXML(w, http.StatusOK, S.LegalHold{Status: status})
+}
+
+func PutObjectLegalHold(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutObjectLegalHold: %v\n", r)
+
+	if _, enabled := objectLockEnabled(app, r.Bucket); !enabled {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", errors.New("bucket is missing object lock configuration"), r.Bucket)
+	}
+
+	var legalHold S.LegalHold
+	if err := decodeXMLBody(req, &legalHold); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Key)
+	}
+	if legalHold.Status != "ON" && legalHold.Status != "OFF" {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", errors.New("invalid legal hold status"), r.Key)
+	}
+
+	err := updateObjectMeta(app, r.Bucket, r.Key, r.VersionID, func(meta *S.ObjectMeta) error {
+		meta.LegalHold = legalHold.Status == "ON"
+		return nil
+	})
+	if err != nil {
+		return respondObjectError(app, w, r, err)
+	}
+
+	return app.Respond(w, http.StatusOK, nil, nil)
+}
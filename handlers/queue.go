@@ -0,0 +1,71 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+// Background work like event notifications and replication is queued as
+// metadata entries
+//
+//	<queue>/<unix nano>-<random>.json
+//
+// before the request completes and removed once it succeeded, so every
+// entry is processed at least once and in order.
+
+const maxRetryBackoff = time.Hour
+
+func queueEntry(app *S.App, queue string, now time.Time, v any) error {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return writeQueueEntry(app, queue, fmt.Sprintf("%020d-%s.json", now.UnixNano(), hex.EncodeToString(suffix)), v)
+}
+
+func writeQueueEntry(app *S.App, queue string, name string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return app.Backend.WriteMetadata(queue+"/"+name, b)
+}
+
+// queueEntries returns the names of the entries of queue in order.
+func queueEntries(app *S.App, queue string) ([]string, error) {
+	names, err := app.Backend.ListMetadata(queue)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []string{}
+	for _, name := range names {
+		if strings.HasSuffix(name, ".json") {
+			entries = append(entries, name)
+		}
+	}
+	return entries, nil
+}
+
+// retryBackoff returns the delay after the given number of failed attempts.
+func retryBackoff(attempts int) time.Duration {
+	if attempts >= 12 {
+		return maxRetryBackoff
+	}
+	return min(time.Second<<attempts, maxRetryBackoff)
+}
+
+// wake signals a worker without blocking.
+func wake(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
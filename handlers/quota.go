@@ -0,0 +1,256 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+var errQuotaExceeded = errors.New("bucket quota exceeded")
+
+func GetBucketQuota(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#GetBucketQuota: %v\n", r)
+
+	if !isAdmin(req) {
+		return app.RespondError(w, http.StatusForbidden, "AccessDenied", errors.New("quotas require long-term credentials"), r.Bucket)
+	}
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var quota S.BucketQuota
+	if _, err := readBucketConfig(app, r.Bucket, "quota", &quota); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+	usage, err := bucketUsage(app, r.Bucket)
+	if err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+	quota.Usage = &usage
+
+	return app.RespondXML(w, http.StatusOK, quota)
+}
+
+func PutBucketQuota(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutBucketQuota: %v\n", r)
+
+	if !isAdmin(req) {
+		return app.RespondError(w, http.StatusForbidden, "AccessDenied", errors.New("quotas require long-term credentials"), r.Bucket)
+	}
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var quota S.BucketQuota
+	if err := decodeXMLBody(req, &quota); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Bucket)
+	}
+	if err := quota.Validate(); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, r.Bucket)
+	}
+	quota.Usage = nil
+
+	// counting starts before the quota is enforced
+	if _, err := bucketUsage(app, r.Bucket); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+	if err := writeBucketConfig(app, r.Bucket, "quota", quota); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusOK, nil, nil)
+}
+
+func DeleteBucketQuota(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#DeleteBucketQuota: %v\n", r)
+
+	if !isAdmin(req) {
+		return app.RespondError(w, http.StatusForbidden, "AccessDenied", errors.New("quotas require long-term credentials"), r.Bucket)
+	}
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	if err := deleteBucketConfig(app, r.Bucket, "quota"); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusNoContent, nil, nil)
+}
+
+// isAdmin reports whether the request is signed with the long-term
+// credentials, temporary credentials can not manage quotas.
+func isAdmin(req *http.Request) bool {
+	c := S.RequestCredentials(req)
+	return c != nil && !c.Temporary()
+}
+
+func bucketUsageName(bucket string) string {
+	return "buckets/" + bucket + "/usage.json"
+}
+
+// bucketUsage returns the usage counters of a bucket. They are counted once
+// and then maintained by commitObjectIndex.
+func bucketUsage(app *S.App, bucket string) (S.BucketUsage, error) {
+	app.UsageMu.Lock()
+	defer app.UsageMu.Unlock()
+
+	var usage S.BucketUsage
+	b, err := app.Backend.ReadMetadata(bucketUsageName(bucket))
+	if err == nil {
+		return usage, json.Unmarshal(b, &usage)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return usage, err
+	}
+
+	keys, err := app.Backend.ListKeys(bucket, "")
+	if err != nil {
+		return usage, err
+	}
+	for _, key := range keys {
+		idx, err := readObjectIndex(app, bucket, key)
+		if err != nil {
+			return usage, err
+		}
+		usage = usage.Add(S.IndexUsage(idx))
+	}
+	return usage, writeBucketUsage(app, bucket, usage)
+}
+
+func writeBucketUsage(app *S.App, bucket string, usage S.BucketUsage) error {
+	b, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	return app.Backend.WriteMetadata(bucketUsageName(bucket), b)
+}
+
+// commitObjectIndex writes the index of a key and adds the change since
+// before to the usage counters of the bucket, if they are counted yet.
+func commitObjectIndex(app *S.App, bucket string, idx *S.ObjectIndex, before S.BucketUsage) error {
+	if err := app.Backend.WriteObjectIndex(bucket, idx); err != nil {
+		return err
+	}
+
+	delta := S.IndexUsage(idx).Sub(before)
+	if delta == (S.BucketUsage{}) {
+		return nil
+	}
+
+	app.UsageMu.Lock()
+	defer app.UsageMu.Unlock()
+	b, err := app.Backend.ReadMetadata(bucketUsageName(bucket))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	var usage S.BucketUsage
+	if err == nil {
+		err = json.Unmarshal(b, &usage)
+	}
+	if err != nil {
+		// recounted on next use
+		log.Printf("can not update usage of %s: %v", bucket, err)
+		app.Backend.DeleteMetadata(bucketUsageName(bucket))
+		return nil
+	}
+	if err := writeBucketUsage(app, bucket, usage.Add(delta)); err != nil {
+		log.Printf("can not update usage of %s: %v", bucket, err)
+	}
+	return nil
+}
+
+// quotaReader limits a new version to the bytes left by the quota.
+func quotaReader(app *S.App, bucket string, idx *S.ObjectIndex, body io.Reader) (io.Reader, error) {
+	var quota S.BucketQuota
+	found, err := readBucketConfig(app, bucket, "quota", &quota)
+	if err != nil || !found {
+		return body, err
+	}
+
+	remaining, err := quotaRemaining(app, bucket, &quota, idx)
+	if err != nil {
+		return nil, err
+	}
+	if remaining < 0 {
+		return body, nil
+	}
+	return &limitedReader{body, remaining}, nil
+}
+
+// lockQuota checks again that a new version of size bytes fits into the
+// quota, concurrent uploads may have used it up while the body was
+// received. The returned function unlocks the usage of the bucket, which
+// stays locked until the index of the new version was committed.
+func lockQuota(app *S.App, bucket string, idx *S.ObjectIndex, size int64) (func(), error) {
+	var quota S.BucketQuota
+	found, err := readBucketConfig(app, bucket, "quota", &quota)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return func() {}, nil
+	}
+
+	unlock := app.QuotaLocks.Lock(bucket, "")
+	remaining, err := quotaRemaining(app, bucket, &quota, idx)
+	if err == nil && remaining >= 0 && size > remaining {
+		err = errQuotaExceeded
+	}
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// quotaRemaining returns the bytes a new version of the key may have, -1
+// if bytes are unlimited.
+func quotaRemaining(app *S.App, bucket string, quota *S.BucketQuota, idx *S.ObjectIndex) (int64, error) {
+	usage, err := bucketUsage(app, bucket)
+	if err != nil {
+		return 0, err
+	}
+	// a new null version replaces the existing one
+	if bucketVersioning(app, bucket) != "Enabled" {
+		if i := idx.Find("null"); i >= 0 && !idx.Versions[i].DeleteMarker {
+			usage = usage.Sub(S.BucketUsage{Bytes: idx.Versions[i].Size, Objects: 1})
+		}
+	}
+
+	remaining, ok := quota.Remaining(usage)
+	if !ok {
+		return 0, errQuotaExceeded
+	}
+	return remaining, nil
+}
+
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// probe whether the body ends exactly at the limit
+		n, err := l.r.Read(make([]byte, 1))
+		if n > 0 {
+			return 0, errQuotaExceeded
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,397 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+var replicationClient = &http.Client{Timeout: 5 * time.Minute}
+
+// replication is a queued copy of a version or delete marker to a target.
+type replication struct {
+	Bucket            string
+	Key               string
+	VersionID         string
+	DeleteMarker      bool
+	Target            string
+	DestinationBucket string
+	Attempts          int
+	NextAttempt       time.Time
+}
+
+func GetBucketReplication(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#GetBucketReplication: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var config S.ReplicationConfiguration
+	found, err := readBucketConfig(app, r.Bucket, "replication", &config)
+	if err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+	if !found {
+		return app.RespondError(w, http.StatusNotFound, "ReplicationConfigurationNotFoundError", errors.New("replication configuration does not exist"), r.Bucket)
+	}
+
+	return app.RespondXML(w, http.StatusOK, config)
+}
+
+func PutBucketReplication(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutBucketReplication: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+	if bucketVersioning(app, r.Bucket) != "Enabled" {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", errors.New("versioning must be enabled on the source bucket"), r.Bucket)
+	}
+
+	var config S.ReplicationConfiguration
+	if err := decodeXMLBody(req, &config); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Bucket)
+	}
+	if err := config.Validate(app.Replication); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", err, r.Bucket)
+	}
+
+	if err := writeBucketConfig(app, r.Bucket, "replication", config); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusOK, nil, nil)
+}
+
+func DeleteBucketReplication(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#DeleteBucketReplication: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	if err := deleteBucketConfig(app, r.Bucket, "replication"); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusNoContent, nil, nil)
+}
+
+// replicationRule returns the rule replicating key with tags or nil.
+func replicationRule(app *S.App, bucket string, key string, tags map[string]string) *S.ReplicationRule {
+	if len(app.Replication) == 0 {
+		return nil
+	}
+
+	var config S.ReplicationConfiguration
+	found, err := readBucketConfig(app, bucket, "replication", &config)
+	if err != nil {
+		log.Printf("can not read replication configuration of %s: %v", bucket, err)
+		return nil
+	}
+	if !found {
+		return nil
+	}
+	return config.Match(key, tags)
+}
+
+// replicate queues a new version for replication and marks it PENDING.
+// Versions encrypted with customer provided keys can not be replicated.
+func replicate(app *S.App, bucket string, key string, meta *S.ObjectMeta) {
+	rule := replicationRule(app, bucket, key, meta.Tags)
+	if rule == nil || len(meta.SSECustomerAlgorithm) > 0 {
+		return
+	}
+
+	err := updateObjectMeta(app, bucket, key, meta.VersionID, func(m *S.ObjectMeta) error {
+		m.ReplicationStatus = "PENDING"
+		return nil
+	})
+	if err != nil {
+		log.Printf("can not mark %s/%s for replication: %v", bucket, key, err)
+		return
+	}
+	meta.ReplicationStatus = "PENDING"
+
+	queueReplication(app, &replication{Bucket: bucket, Key: key, VersionID: meta.VersionID, Target: rule.Destination.Account, DestinationBucket: rule.Destination.DestinationBucket()})
+}
+
+// replicateDeleted queues a created delete marker if the rule replicates
+// delete markers. Deleting a specific version is never replicated.
+func replicateDeleted(app *S.App, bucket string, deleted S.DeletedObject) {
+	if !deleted.DeleteMarker || len(deleted.DeleteMarkerVersionID) == 0 {
+		return
+	}
+	rule := replicationRule(app, bucket, deleted.Key, nil)
+	if rule == nil || !rule.ReplicatesDeleteMarkers() {
+		return
+	}
+
+	queueReplication(app, &replication{Bucket: bucket, Key: deleted.Key, VersionID: deleted.DeleteMarkerVersionID, DeleteMarker: true, Target: rule.Destination.Account, DestinationBucket: rule.Destination.DestinationBucket()})
+}
+
+func queueReplication(app *S.App, e *replication) {
+	now := time.Now()
+	e.NextAttempt = now
+	if err := queueEntry(app, "replication", now, e); err != nil {
+		log.Printf("can not queue replication of %s/%s: %v", e.Bucket, e.Key, err)
+		return
+	}
+	wake(app.ReplicationWake)
+}
+
+func ReplicationWorker(ctx context.Context, app *S.App, interval time.Duration) {
+	for {
+		ReplicateObjects(app, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-app.ReplicationWake:
+		case <-time.After(interval):
+		}
+	}
+}
+
+// ReplicateObjects copies the queued versions which are due in order. After
+// a failure the version is marked FAILED and later entries of the same
+// target wait for the retry.
+func ReplicateObjects(app *S.App, now time.Time) {
+	names, err := queueEntries(app, "replication")
+	if err != nil {
+		log.Printf("can not read replication queue: %v", err)
+		return
+	}
+
+	blocked := make(map[string]bool)
+	for _, name := range names {
+		b, err := app.Backend.ReadMetadata("replication/" + name)
+		if err != nil {
+			log.Printf("can not read replication %s: %v", name, err)
+			continue
+		}
+		var e replication
+		if err := json.Unmarshal(b, &e); err != nil {
+			log.Printf("dropping corrupt replication %s: %v", name, err)
+			app.Backend.DeleteMetadata("replication/" + name)
+			continue
+		}
+		if blocked[e.Target] {
+			continue
+		}
+		if now.Before(e.NextAttempt) {
+			blocked[e.Target] = true
+			continue
+		}
+
+		target, ok := app.Replication[e.Target]
+		if !ok {
+			log.Printf("dropping replication %s for unknown target %s", name, e.Target)
+			setReplicationStatus(app, &e, "FAILED")
+			app.Backend.DeleteMetadata("replication/" + name)
+			continue
+		}
+
+		err = replicateVersion(app, target, &e)
+		if errors.Is(err, errNoSuchKey) || errors.Is(err, errNoSuchVersion) {
+			// the version was deleted in the meantime
+			app.Backend.DeleteMetadata("replication/" + name)
+			continue
+		}
+		if err != nil {
+			e.Attempts++
+			e.NextAttempt = now.Add(retryBackoff(e.Attempts))
+			log.Printf("replication of %s/%s to %s failed %d times, retry at %v: %v", e.Bucket, e.Key, target.Name, e.Attempts, e.NextAttempt, err)
+			setReplicationStatus(app, &e, "FAILED")
+			if err := writeQueueEntry(app, "replication", name, &e); err != nil {
+				log.Printf("can not update replication %s: %v", name, err)
+			}
+			blocked[e.Target] = true
+			continue
+		}
+
+		setReplicationStatus(app, &e, "COMPLETED")
+		if err := app.Backend.DeleteMetadata("replication/" + name); err != nil {
+			log.Printf("can not remove replication %s: %v", name, err)
+		}
+	}
+}
+
+func setReplicationStatus(app *S.App, e *replication, status string) {
+	if e.DeleteMarker {
+		return
+	}
+	err := updateObjectMeta(app, e.Bucket, e.Key, e.VersionID, func(m *S.ObjectMeta) error {
+		m.ReplicationStatus = status
+		return nil
+	})
+	if err != nil && !errors.Is(err, errNoSuchKey) && !errors.Is(err, errNoSuchVersion) {
+		log.Printf("can not update replication status of %s/%s: %v", e.Bucket, e.Key, err)
+	}
+}
+
+// replicateVersion copies the queued version to the target.
+func replicateVersion(app *S.App, target *S.ReplicationTarget, e *replication) error {
+	idx, i, err := lookupVersion(app, e.Bucket, e.Key, e.VersionID)
+	if err != nil {
+		return err
+	}
+
+	if e.DeleteMarker {
+		if len(target.Path) > 0 {
+			return deleteReplicaFile(target, e.DestinationBucket, e.Key)
+		}
+		return sendReplica(target, http.MethodDelete, e.DestinationBucket, e.Key, nil, nil, S.HexSHA256Hash(nil))
+	}
+
+	meta := idx.Versions[i]
+	open := func() (io.ReadCloser, error) {
+		return openObjectData(app, e.Bucket, idx, i, 0, nil)
+	}
+
+	if len(target.Path) > 0 {
+		return writeReplicaFile(target, e.DestinationBucket, e.Key, open)
+	}
+
+	// the payload hash has to be known before streaming the data
+	data, err := open()
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, data)
+	data.Close()
+	if err != nil {
+		return err
+	}
+
+	data, err = open()
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	header := make(http.Header)
+	if len(meta.ContentType) > 0 {
+		header.Set("Content-Type", meta.ContentType)
+	}
+	for k, v := range meta.UserMetadata {
+		header.Set(k, v)
+	}
+	if len(meta.Tags) > 0 {
+		tags := url.Values{}
+		for k, v := range meta.Tags {
+			tags.Set(k, v)
+		}
+		header.Set("X-Amz-Tagging", tags.Encode())
+	}
+	return sendReplica(target, http.MethodPut, e.DestinationBucket, e.Key, header, &sizedReader{data, meta.Size}, hex.EncodeToString(hash.Sum(nil)))
+}
+
+type sizedReader struct {
+	io.Reader
+	size int64
+}
+
+func sendReplica(target *S.ReplicationTarget, method string, bucket string, key string, header http.Header, body *sizedReader, payloadHash string) error {
+	u, err := url.Parse(target.Endpoint)
+	if err != nil {
+		return err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket + "/" + key
+
+	var reader io.Reader
+	if body != nil {
+		reader = body
+	}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.ContentLength = body.size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	S.SignV4(req, payloadHash, target.AccessKey, target.SecretKey, target.Region, time.Now())
+
+	res, err := replicationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s %s responded %s: %s", method, u.Path, res.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// replicaPath returns the file of key in the target directory.
+func replicaPath(target *S.ReplicationTarget, bucket string, key string) (string, error) {
+	root := filepath.Join(target.Path, bucket)
+	path := filepath.Join(root, key)
+	if !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid key %s", key)
+	}
+	return path, nil
+}
+
+func writeReplicaFile(target *S.ReplicationTarget, bucket string, key string, open func() (io.ReadCloser, error)) error {
+	path, err := replicaPath(target, bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	data, err := open()
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".replica-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func deleteReplicaFile(target *S.ReplicationTarget, bucket string, key string) error {
+	path, err := replicaPath(target, bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
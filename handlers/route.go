@@ -4,15 +4,16 @@
 package handlers
 
 import (
+	"errors"
+	"io/fs"
 	"log"
 	"net/http"
-	"os"
 
 	S "github.com/autovia/s3-go/structs"
 )
 
 func Get(a *S.App, w http.ResponseWriter, req *http.Request) error {
-	log.Printf(">>> GET %v\n", req)
+	log.Printf(">>> GET %s%s\n", req.Host, req.URL.Path)
 
 	if req.URL.Path == "/" {
 		return ListBuckets(a, w, req)
@@ -20,35 +21,149 @@ func Get(a *S.App, w http.ResponseWriter, req *http.Request) error {
 
 	r, err := a.ParseRequest(req)
 	if err != nil {
-		return a.RespondError(w, 500, "InternalError", err, r.Bucket)
-	}
-
-	stat, err := os.Stat(r.Path)
-	if os.IsNotExist(err) {
-		return a.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+		return respondRequestError(a, w, req, err)
 	}
 
 	if req.URL.Query().Has("versioning") {
 		return GetBucketVersioning(a, w, r)
 	}
 
-	if stat.IsDir() {
-		return ListObjectsV2(a, w, r)
+	if req.URL.Query().Has("events") {
+		return ListenBucketEvents(a, w, r, req)
 	}
 
 	if req.URL.Query().Has("versions") {
-		return ListObjectVersions(a, w, r)
+		return ListObjectVersions(a, w, r, req)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("cors") {
+		return GetBucketCors(a, w, r)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("encryption") {
+		return GetBucketEncryption(a, w, r)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("lifecycle") {
+		return GetBucketLifecycleConfiguration(a, w, r)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("logging") {
+		return GetBucketLogging(a, w, r)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("notification") {
+		return GetBucketNotificationConfiguration(a, w, r)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("quota") {
+		return GetBucketQuota(a, w, r, req)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("replication") {
+		return GetBucketReplication(a, w, r)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("object-lock") {
+		return GetObjectLockConfiguration(a, w, r)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("website") {
+		return GetBucketWebsite(a, w, r)
+	}
+
+	if len(r.Key) > 0 && req.URL.Query().Has("retention") {
+		return GetObjectRetention(a, w, r)
 	}
 
-	return GetObject(a, w, r)
+	if req.URL.Query().Has("tagging") {
+		if len(r.Key) > 0 {
+			return GetObjectTagging(a, w, r)
+		}
+		return GetBucketTagging(a, w, r)
+	}
+
+	if len(r.Key) > 0 && req.URL.Query().Has("legal-hold") {
+		return GetObjectLegalHold(a, w, r)
+	}
+
+	stat, err := a.Backend.StatObject(r.Bucket, r.Key)
+	if errors.Is(err, fs.ErrNotExist) {
+		// the latest version may be a delete marker
+		if len(r.Key) > 0 && !req.URL.Query().Has("prefix") {
+			return GetObject(a, w, r, req)
+		}
+		return a.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	if stat.IsDir {
+		return ListObjectsV2(a, w, r)
+	}
+
+	return GetObject(a, w, r, req)
 }
 
 func Put(a *S.App, w http.ResponseWriter, req *http.Request) error {
-	log.Printf(">>> PUT %v\n", req)
+	log.Printf(">>> PUT %s%s\n", req.Host, req.URL.Path)
 
 	r, err := a.ParseRequest(req)
 	if err != nil {
-		return a.RespondError(w, 500, "InternalError", err, r.Bucket)
+		return respondRequestError(a, w, req, err)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("versioning") {
+		return PutBucketVersioning(a, w, r, req)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("cors") {
+		return PutBucketCors(a, w, r, req)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("encryption") {
+		return PutBucketEncryption(a, w, r, req)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("lifecycle") {
+		return PutBucketLifecycleConfiguration(a, w, r, req)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("logging") {
+		return PutBucketLogging(a, w, r, req)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("notification") {
+		return PutBucketNotificationConfiguration(a, w, r, req)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("quota") {
+		return PutBucketQuota(a, w, r, req)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("replication") {
+		return PutBucketReplication(a, w, r, req)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("object-lock") {
+		return PutObjectLockConfiguration(a, w, r, req)
+	}
+
+	if len(r.Key) == 0 && req.URL.Query().Has("website") {
+		return PutBucketWebsite(a, w, r, req)
+	}
+
+	if len(r.Key) > 0 && req.URL.Query().Has("retention") {
+		return PutObjectRetention(a, w, r, req)
+	}
+
+	if req.URL.Query().Has("tagging") {
+		if len(r.Key) > 0 {
+			return PutObjectTagging(a, w, r, req)
+		}
+		return PutBucketTagging(a, w, r, req)
+	}
+
+	if len(r.Key) > 0 && req.URL.Query().Has("legal-hold") {
+		return PutObjectLegalHold(a, w, r, req)
 	}
 
 	if len(r.Key) > 0 {
@@ -58,19 +173,28 @@ func Put(a *S.App, w http.ResponseWriter, req *http.Request) error {
 		return PutObject(a, w, r, req)
 	}
 
-	return CreateBucket(a, w, r)
+	return CreateBucket(a, w, r, req)
 }
 
 func Post(a *S.App, w http.ResponseWriter, req *http.Request) error {
-	log.Printf(">>> POST %v\n", req)
+	log.Printf(">>> POST %s%s\n", req.Host, req.URL.Path)
+
+	if req.URL.Path == "/" {
+		return STS(a, w, req)
+	}
 
 	r, err := a.ParseRequest(req)
 	if err != nil {
-		return a.RespondError(w, 500, "InternalError", err, "")
+		return respondRequestError(a, w, req, err)
+	}
+
+	// unsigned, the handler checks the policy signature of the form
+	if S.IsPostObject(req) {
+		return PostObject(a, w, r, req)
 	}
 
 	if req.URL.Query().Has("uploads") {
-		return CreateMultipartUpload(a, w, r)
+		return CreateMultipartUpload(a, w, r, req)
 	}
 
 	if req.URL.Query().Has("delete") {
@@ -81,30 +205,84 @@ func Post(a *S.App, w http.ResponseWriter, req *http.Request) error {
 }
 
 func Delete(a *S.App, w http.ResponseWriter, req *http.Request) error {
-	log.Printf(">>> DELETE %v\n", req)
+	log.Printf(">>> DELETE %s%s\n", req.Host, req.URL.Path)
 
 	r, err := a.ParseRequest(req)
 	if err != nil {
-		return a.RespondError(w, 500, "InternalError", err, r.Bucket)
+		return respondRequestError(a, w, req, err)
+	}
+
+	if req.URL.Query().Has("tagging") {
+		if len(r.Key) > 0 {
+			return DeleteObjectTagging(a, w, r)
+		}
+		return DeleteBucketTagging(a, w, r)
 	}
 
 	if len(r.Key) > 0 {
-		return DeleteObject(a, w, r)
+		return DeleteObject(a, w, r, req)
+	}
+
+	if req.URL.Query().Has("cors") {
+		return DeleteBucketCors(a, w, r)
+	}
+
+	if req.URL.Query().Has("encryption") {
+		return DeleteBucketEncryption(a, w, r)
+	}
+
+	if req.URL.Query().Has("lifecycle") {
+		return DeleteBucketLifecycle(a, w, r)
+	}
+
+	if req.URL.Query().Has("quota") {
+		return DeleteBucketQuota(a, w, r, req)
+	}
+
+	if req.URL.Query().Has("replication") {
+		return DeleteBucketReplication(a, w, r)
+	}
+
+	if req.URL.Query().Has("website") {
+		return DeleteBucketWebsite(a, w, r)
 	}
 
 	return DeleteBucket(a, w, r)
 }
 
 func Head(a *S.App, w http.ResponseWriter, req *http.Request) error {
-	log.Printf(">>> HEAD %v\n", req)
+	log.Printf(">>> HEAD %s%s\n", req.Host, req.URL.Path)
 
 	r, err := a.ParseRequest(req)
 	if err != nil {
-		return a.RespondError(w, 500, "InternalError", err, r.Bucket)
+		return respondRequestError(a, w, req, err)
 	}
 
 	if len(r.Key) > 0 {
-		return HeadObject(a, w, r)
+		return HeadObject(a, w, r, req)
 	}
 	return HeadBucket(a, w, r)
 }
+
+func Options(a *S.App, w http.ResponseWriter, req *http.Request) error {
+	log.Printf(">>> OPTIONS %s%s\n", req.Host, req.URL.Path)
+
+	r, err := a.ParseRequest(req)
+	if err != nil {
+		return respondRequestError(a, w, req, err)
+	}
+
+	return PreflightRequest(a, w, r, req)
+}
+
+// respondRequestError answers requests whose path can not be parsed.
+func respondRequestError(a *S.App, w http.ResponseWriter, req *http.Request, err error) error {
+	switch {
+	case errors.Is(err, S.ErrKeyTooLong):
+		return a.RespondError(w, http.StatusBadRequest, "KeyTooLongError", err, req.URL.Path)
+	case errors.Is(err, S.ErrInvalidKey):
+		return a.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, req.URL.Path)
+	default:
+		return a.RespondError(w, http.StatusBadRequest, "InvalidRequest", err, req.URL.Path)
+	}
+}
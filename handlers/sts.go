@@ -0,0 +1,217 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+func STS(app *S.App, w http.ResponseWriter, req *http.Request) error {
+	log.Printf("#STS %v\n", req)
+
+	if err := req.ParseForm(); err != nil {
+		return respondSTSError(app, w, http.StatusBadRequest, "InvalidParameterValue", err)
+	}
+
+	switch action := req.PostForm.Get("Action"); action {
+	case "AssumeRole":
+		return AssumeRole(app, w, req)
+	case "GetSessionToken":
+		return GetSessionToken(app, w, req)
+	case "AssumeRoleWithWebIdentity":
+		return AssumeRoleWithWebIdentity(app, w, req)
+	default:
+		return respondSTSError(app, w, http.StatusBadRequest, "InvalidAction", errors.New("could not find operation "+action))
+	}
+}
+
+func AssumeRole(app *S.App, w http.ResponseWriter, req *http.Request) error {
+	log.Printf("#AssumeRole\n")
+
+	caller := S.RequestCredentials(req)
+	if caller == nil || caller.Temporary() {
+		return respondSTSError(app, w, http.StatusForbidden, "AccessDenied", errors.New("AssumeRole requires long-term credentials"))
+	}
+
+	roleArn := req.PostForm.Get("RoleArn")
+	if len(roleArn) < 20 {
+		return respondSTSError(app, w, http.StatusBadRequest, "ValidationError", errors.New("value at 'roleArn' failed to satisfy constraint"))
+	}
+
+	sessionName := req.PostForm.Get("RoleSessionName")
+	if len(sessionName) < 2 || len(sessionName) > 64 {
+		return respondSTSError(app, w, http.StatusBadRequest, "ValidationError", errors.New("value at 'roleSessionName' failed to satisfy constraint"))
+	}
+
+	duration, err := stsDuration(req.PostForm.Get("DurationSeconds"), time.Hour, 12*time.Hour)
+	if err != nil {
+		return respondSTSError(app, w, http.StatusBadRequest, "ValidationError", err)
+	}
+
+	policies, err := stsSessionPolicy(req.PostForm.Get("Policy"))
+	if err != nil {
+		return respondSTSError(app, w, http.StatusBadRequest, "MalformedPolicyDocument", err)
+	}
+
+	role := roleArn[strings.LastIndex(roleArn, "/")+1:]
+	arn := strings.Replace(roleArn, ":iam::", ":sts::", 1)
+	arn = strings.Replace(arn, ":role/", ":assumed-role/", 1) + "/" + sessionName
+	credentials := app.Credentials.Issue(arn, duration, policies...)
+
+	response := S.AssumeRoleResponse{Xmlns: S.STSNamespace}
+	response.Result.Credentials = stsCredentials(credentials)
+	response.Result.AssumedRoleUser = S.AssumedRoleUser{
+		Arn:           arn,
+		AssumedRoleID: "AROA" + strings.ToUpper(generate(17)) + ":" + sessionName,
+	}
+	if len(policies) > 0 {
+		response.Result.PackedPolicySize = len(req.PostForm.Get("Policy")) * 100 / 2048
+	}
+	response.ResponseMetadata.RequestID = generate(32)
+	log.Printf("issued temporary credentials %s for %s", credentials.AccessKey, role)
+
+	return app.RespondXML(w, http.StatusOK, response)
+}
+
+func AssumeRoleWithWebIdentity(app *S.App, w http.ResponseWriter, req *http.Request) error {
+	log.Printf("#AssumeRoleWithWebIdentity\n")
+
+	if app.OIDC == nil {
+		return respondSTSError(app, w, http.StatusBadRequest, "InvalidIdentityToken", errors.New("no web identity provider configured"))
+	}
+
+	roleArn := req.PostForm.Get("RoleArn")
+	if len(roleArn) < 20 {
+		return respondSTSError(app, w, http.StatusBadRequest, "ValidationError", errors.New("value at 'roleArn' failed to satisfy constraint"))
+	}
+
+	sessionName := req.PostForm.Get("RoleSessionName")
+	if len(sessionName) < 2 || len(sessionName) > 64 {
+		return respondSTSError(app, w, http.StatusBadRequest, "ValidationError", errors.New("value at 'roleSessionName' failed to satisfy constraint"))
+	}
+
+	duration, err := stsDuration(req.PostForm.Get("DurationSeconds"), time.Hour, 12*time.Hour)
+	if err != nil {
+		return respondSTSError(app, w, http.StatusBadRequest, "ValidationError", err)
+	}
+
+	claims, err := app.OIDC.Verify(req.PostForm.Get("WebIdentityToken"))
+	if err != nil {
+		if errors.Is(err, S.ErrTokenExpired) {
+			return respondSTSError(app, w, http.StatusBadRequest, "ExpiredTokenException", err)
+		}
+		return respondSTSError(app, w, http.StatusBadRequest, "InvalidIdentityToken", err)
+	}
+
+	// the mapped policies grant access, a session policy can only narrow it down
+	policies := app.OIDC.Policies(claims)
+	if len(policies) == 0 {
+		return respondSTSError(app, w, http.StatusForbidden, "AccessDenied", fmt.Errorf("no policy for subject %v", claims["sub"]))
+	}
+	sessionPolicies, err := stsSessionPolicy(req.PostForm.Get("Policy"))
+	if err != nil {
+		return respondSTSError(app, w, http.StatusBadRequest, "MalformedPolicyDocument", err)
+	}
+	merged := S.IAMPolicy{Version: "2012-10-17"}
+	for _, p := range policies {
+		merged.Statement = append(merged.Statement, p.Statement...)
+	}
+
+	arn := strings.Replace(roleArn, ":iam::", ":sts::", 1)
+	arn = strings.Replace(arn, ":role/", ":assumed-role/", 1) + "/" + sessionName
+	credentials := app.Credentials.Issue(arn, duration, append([]S.IAMPolicy{merged}, sessionPolicies...)...)
+
+	subject, _ := claims["sub"].(string)
+	issuer, _ := claims["iss"].(string)
+	response := S.AssumeRoleWithWebIdentityResponse{Xmlns: S.STSNamespace}
+	response.Result.Credentials = stsCredentials(credentials)
+	response.Result.SubjectFromWebIdentityToken = subject
+	response.Result.AssumedRoleUser = S.AssumedRoleUser{
+		Arn:           arn,
+		AssumedRoleID: "AROA" + strings.ToUpper(generate(17)) + ":" + sessionName,
+	}
+	response.Result.Provider = issuer
+	// Verify only accepts tokens issued for the configured audience
+	response.Result.Audience = app.OIDC.Audience
+	response.ResponseMetadata.RequestID = generate(32)
+	log.Printf("issued temporary credentials %s for %s", credentials.AccessKey, subject)
+
+	return app.RespondXML(w, http.StatusOK, response)
+}
+
+func GetSessionToken(app *S.App, w http.ResponseWriter, req *http.Request) error {
+	log.Printf("#GetSessionToken\n")
+
+	caller := S.RequestCredentials(req)
+	if caller == nil || caller.Temporary() {
+		return respondSTSError(app, w, http.StatusForbidden, "AccessDenied", errors.New("GetSessionToken requires long-term credentials"))
+	}
+
+	duration, err := stsDuration(req.PostForm.Get("DurationSeconds"), 12*time.Hour, 36*time.Hour)
+	if err != nil {
+		return respondSTSError(app, w, http.StatusBadRequest, "ValidationError", err)
+	}
+
+	credentials := app.Credentials.Issue(caller.Arn, duration)
+
+	response := S.GetSessionTokenResponse{Xmlns: S.STSNamespace}
+	response.Result.Credentials = stsCredentials(credentials)
+	response.ResponseMetadata.RequestID = generate(32)
+
+	return app.RespondXML(w, http.StatusOK, response)
+}
+
+func stsSessionPolicy(policy string) ([]S.IAMPolicy, error) {
+	if len(policy) == 0 {
+		return nil, nil
+	}
+	if len(policy) > 2048 {
+		return nil, errors.New("policy exceeds 2048 characters")
+	}
+	p, err := S.ParseIAMPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	return []S.IAMPolicy{*p}, nil
+}
+
+func stsDuration(value string, def time.Duration, max time.Duration) (time.Duration, error) {
+	if len(value) == 0 {
+		return def, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.New("value at 'durationSeconds' is not a number")
+	}
+	duration := time.Duration(seconds) * time.Second
+	if duration < 15*time.Minute || duration > max {
+		return 0, errors.New("value at 'durationSeconds' failed to satisfy constraint")
+	}
+	return duration, nil
+}
+
+func stsCredentials(c *S.Credentials) S.STSCredentials {
+	return S.STSCredentials{
+		AccessKeyID:     c.AccessKey,
+		SecretAccessKey: c.SecretKey,
+		SessionToken:    c.SessionToken,
+		Expiration:      c.Expiration.Format(time.RFC3339),
+	}
+}
+
+func respondSTSError(app *S.App, w http.ResponseWriter, httpcode int, code string, err error) error {
+	response := S.STSErrorResponse{Xmlns: S.STSNamespace, RequestID: generate(32)}
+	response.Error.Type = "Sender"
+	response.Error.Code = code
+	response.Error.Message = err.Error()
+	return app.RespondXML(w, httpcode, response)
+}
@@ -0,0 +1,126 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+func GetObjectTagging(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#GetObjectTagging: %v\n", r)
+
+	idx, i, err := lookupVersion(app, r.Bucket, r.Key, r.VersionID)
+	if err != nil || idx.Versions[i].DeleteMarker {
+		return respondNoSuchVersion(app, w, r, idx, i, err)
+	}
+
+	if len(bucketVersioning(app, r.Bucket)) > 0 {
+		w.Header().Set("X-Amz-Version-Id", idx.Versions[i].VersionID)
+	}
+	return app.RespondXML(w, http.StatusOK, S.Tagging{TagSet: S.TagSet(idx.Versions[i].Tags)})
+}
+
+func PutObjectTagging(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutObjectTagging: %v\n", r)
+
+	var tagging S.Tagging
+	if err := decodeXMLBody(req, &tagging); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Key)
+	}
+	tags, err := S.TagMap(tagging.TagSet, S.MaxObjectTags)
+	if err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidTag", err, r.Key)
+	}
+
+	return updateObjectTags(app, w, r, tags)
+}
+
+func DeleteObjectTagging(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#DeleteObjectTagging: %v\n", r)
+
+	return updateObjectTags(app, w, r, nil)
+}
+
+func updateObjectTags(app *S.App, w http.ResponseWriter, r *S.Request, tags map[string]string) error {
+	var versionID string
+	err := updateObjectMeta(app, r.Bucket, r.Key, r.VersionID, func(meta *S.ObjectMeta) error {
+		meta.Tags = tags
+		versionID = meta.VersionID
+		return nil
+	})
+	if err != nil {
+		return respondObjectError(app, w, r, err)
+	}
+
+	headers := make(map[string]string)
+	if len(bucketVersioning(app, r.Bucket)) > 0 {
+		headers["X-Amz-Version-Id"] = versionID
+	}
+	code := http.StatusOK
+	if tags == nil {
+		code = http.StatusNoContent
+	}
+	return app.Respond(w, code, headers, nil)
+}
+
+func GetBucketTagging(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#GetBucketTagging: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var tagging S.Tagging
+	found, err := readBucketConfig(app, r.Bucket, "tagging", &tagging)
+	if err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+	if !found {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchTagSet", errors.New("tag set does not exist"), r.Bucket)
+	}
+
+	return app.RespondXML(w, http.StatusOK, tagging)
+}
+
+func PutBucketTagging(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutBucketTagging: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var tagging S.Tagging
+	if err := decodeXMLBody(req, &tagging); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Bucket)
+	}
+	tags, err := S.TagMap(tagging.TagSet, S.MaxBucketTags)
+	if err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidTag", err, r.Bucket)
+	}
+
+	if err := writeBucketConfig(app, r.Bucket, "tagging", S.Tagging{TagSet: S.TagSet(tags)}); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusNoContent, nil, nil)
+}
+
+func DeleteBucketTagging(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#DeleteBucketTagging: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	if err := deleteBucketConfig(app, r.Bucket, "tagging"); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusNoContent, nil, nil)
+}
@@ -0,0 +1,382 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+var errNoSuchKey = errors.New("NoSuchKey")
+var errNoSuchVersion = errors.New("NoSuchVersion")
+var errObjectLocked = errors.New("object is protected by object lock")
+
+// bucketVersioning returns Enabled, Suspended or an empty string for
+// buckets which never had versioning enabled.
+func bucketVersioning(app *S.App, bucket string) string {
+	var config S.VersioningConfiguration
+	if _, err := readBucketConfig(app, bucket, "versioning", &config); err != nil {
+		log.Printf("can not read versioning of %s: %v", bucket, err)
+	}
+	return config.Status
+}
+
+// dataVersion returns the backend version ID of the data of the i-th
+// version of a key, the data of the latest version is not archived.
+func dataVersion(idx *S.ObjectIndex, i int) string {
+	if i == 0 {
+		return ""
+	}
+	return idx.Versions[i].VersionID
+}
+
+// lookupVersion returns the index of a key and the position of the
+// requested version, the latest version if versionID is empty.
+func lookupVersion(app *S.App, bucket string, key string, versionID string) (*S.ObjectIndex, int, error) {
+	idx, err := readObjectIndex(app, bucket, key)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	if len(versionID) == 0 {
+		if len(idx.Versions) == 0 {
+			return idx, -1, errNoSuchKey
+		}
+		return idx, 0, nil
+	}
+
+	i := idx.Find(versionID)
+	if i < 0 {
+		return idx, -1, errNoSuchVersion
+	}
+	return idx, i, nil
+}
+
+// respondNoSuchVersion writes the error for a lookupVersion failure or a
+// delete marker found in place of the object.
+func respondNoSuchVersion(app *S.App, w http.ResponseWriter, r *S.Request, idx *S.ObjectIndex, i int, err error) error {
+	switch {
+	case errors.Is(err, errNoSuchKey):
+		return app.RespondError(w, http.StatusNotFound, "NoSuchKey", err, r.Key)
+	case errors.Is(err, errNoSuchVersion):
+		return app.RespondError(w, http.StatusNotFound, "NoSuchVersion", err, r.Key)
+	case err != nil:
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+	}
+
+	w.Header().Set("X-Amz-Delete-Marker", "true")
+	w.Header().Set("X-Amz-Version-Id", idx.Versions[i].VersionID)
+	if len(r.VersionID) > 0 {
+		return app.RespondError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", errors.New("version is a delete marker"), r.Key)
+	}
+	return app.RespondError(w, http.StatusNotFound, "NoSuchKey", errors.New("latest version is a delete marker"), r.Key)
+}
+
+// respondObjectError maps errors of version updates to S3 errors.
+func respondObjectError(app *S.App, w http.ResponseWriter, r *S.Request, err error) error {
+	switch {
+	case errors.Is(err, errObjectLocked):
+		return app.RespondError(w, http.StatusForbidden, "AccessDenied", err, r.Key)
+	case errors.Is(err, errNoSuchKey):
+		return app.RespondError(w, http.StatusNotFound, "NoSuchKey", err, r.Key)
+	case errors.Is(err, errNoSuchVersion):
+		return app.RespondError(w, http.StatusNotFound, "NoSuchVersion", err, r.Key)
+	case errors.Is(err, errQuotaExceeded):
+		return app.RespondError(w, http.StatusBadRequest, "QuotaExceeded", err, r.Key)
+	case errors.Is(err, S.ErrEntityTooSmall):
+		return app.RespondError(w, http.StatusBadRequest, "EntityTooSmall", err, r.Key)
+	case errors.Is(err, S.ErrEntityTooLarge):
+		return app.RespondError(w, http.StatusBadRequest, "EntityTooLarge", err, r.Key)
+	case errors.Is(err, S.ErrKeyConflict):
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, r.Key)
+	case errors.Is(err, S.ErrStorageFull):
+		return app.RespondError(w, http.StatusInsufficientStorage, "InsufficientStorage", err, r.Key)
+	case errors.Is(err, errCustomerKeyMismatch):
+		return app.RespondError(w, http.StatusForbidden, "AccessDenied", err, r.Key)
+	case errors.Is(err, errCustomerKeyRequired), errors.Is(err, errCustomerKeyNotApplicable), errors.Is(err, errInsecureCustomerKey):
+		return app.RespondError(w, http.StatusBadRequest, "InvalidRequest", err, r.Key)
+	default:
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Key)
+	}
+}
+
+// archiveLatest makes room for a new latest version and returns its
+// version ID. Depending on the versioning status the data of the current
+// version is moved to the metadata store or dropped. The returned function
+// reverts the move if writing the new version fails. A null version under
+// governance mode retention is only replaced with bypassGovernance.
+func archiveLatest(app *S.App, bucket string, idx *S.ObjectIndex, status string, bypassGovernance bool) (string, func(), error) {
+	versionID := "null"
+	if status == "Enabled" {
+		versionID = generate(32)
+	}
+
+	// a new null version replaces the existing one
+	if i := idx.Find("null"); versionID == "null" && i >= 0 && idx.Versions[i].Locked(bypassGovernance, time.Now()) {
+		return "", nil, errObjectLocked
+	}
+	if i := idx.Find("null"); versionID == "null" && i > 0 {
+		if !idx.Versions[i].DeleteMarker {
+			if err := app.Backend.RemoveObject(bucket, idx.Key, "null"); err != nil {
+				return "", nil, err
+			}
+		}
+		idx.Versions = append(idx.Versions[:i], idx.Versions[i+1:]...)
+	}
+
+	latest := idx.Latest()
+	if latest == nil {
+		return versionID, func() {}, nil
+	}
+
+	if latest.VersionID == "null" && versionID == "null" {
+		// overwritten in place
+		idx.Versions = idx.Versions[1:]
+		return versionID, func() {}, nil
+	}
+
+	if latest.DeleteMarker {
+		return versionID, func() {}, nil
+	}
+
+	archived := latest.VersionID
+	if err := app.Backend.ArchiveObject(bucket, idx.Key, archived); err != nil {
+		return "", nil, err
+	}
+	return versionID, func() { app.Backend.RestoreObject(bucket, idx.Key, archived) }, nil
+}
+
+// putObjectData writes body as the new latest version of a key. The body
+// is received without holding the lock of the key, which is only taken to
+// replace the latest version.
+func putObjectData(app *S.App, bucket string, key string, body io.Reader, meta S.ObjectMeta, customerKey []byte, bypassGovernance bool) (S.ObjectMeta, error) {
+	idx, err := readObjectIndex(app, bucket, key)
+	if err != nil {
+		return meta, err
+	}
+
+	body, err = quotaReader(app, bucket, idx, body)
+	if err != nil {
+		return meta, err
+	}
+
+	dataKey, err := encryptionKey(app, &meta, customerKey)
+	if err != nil {
+		return meta, err
+	}
+
+	// the data is staged until it was received completely, a failed or
+	// aborted upload leaves the current version untouched
+	staged, err := app.Backend.CreateObject(bucket, key)
+	if err != nil {
+		return meta, err
+	}
+
+	var target io.Writer = staged
+	var encrypt io.WriteCloser
+	if dataKey != nil {
+		if encrypt, err = S.NewEncryptWriter(staged, dataKey); err != nil {
+			staged.Abort()
+			return meta, err
+		}
+		target = encrypt
+	}
+
+	hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(target, hash), body)
+	if err == nil && encrypt != nil {
+		err = encrypt.Close()
+	}
+	if err != nil {
+		staged.Abort()
+		return meta, err
+	}
+
+	unlock := app.Locks.Lock(bucket, key)
+	defer unlock()
+
+	// the key may have changed while the body was received
+	idx, err = readObjectIndex(app, bucket, key)
+	if err != nil {
+		staged.Abort()
+		return meta, err
+	}
+	before := S.IndexUsage(idx)
+
+	unlockQuota, err := lockQuota(app, bucket, idx, size)
+	if err != nil {
+		staged.Abort()
+		return meta, err
+	}
+	defer unlockQuota()
+
+	versionID, restore, err := archiveLatest(app, bucket, idx, bucketVersioning(app, bucket), bypassGovernance)
+	if err != nil {
+		staged.Abort()
+		return meta, err
+	}
+	if err := staged.Commit(); err != nil {
+		restore()
+		return meta, err
+	}
+
+	meta.VersionID = versionID
+	meta.ETag = fmt.Sprintf("\"%x\"", hash.Sum(nil))
+	meta.Size = size
+	meta.LastModified = time.Now().UTC()
+	idx.Versions = append([]S.ObjectMeta{meta}, idx.Versions...)
+
+	return meta, commitObjectIndex(app, bucket, idx, before)
+}
+
+// deleteObjectVersion deletes a version of a key or, without versionID,
+// the key itself which creates a delete marker in versioned buckets.
+// Versions protected by object lock are not deleted.
+func deleteObjectVersion(app *S.App, bucket string, key string, versionID string, bypassGovernance bool) (S.DeletedObject, error) {
+	unlock := app.Locks.Lock(bucket, key)
+	defer unlock()
+
+	return deleteLockedVersion(app, bucket, key, versionID, bypassGovernance)
+}
+
+// deleteLockedVersion is deleteObjectVersion for callers holding the lock
+// of the key.
+func deleteLockedVersion(app *S.App, bucket string, key string, versionID string, bypassGovernance bool) (S.DeletedObject, error) {
+	deleted := S.DeletedObject{Key: key}
+
+	// keys ending with a slash are plain directories
+	if stat, err := app.Backend.StatObject(bucket, key); err == nil && stat.IsDir && strings.HasSuffix(key, "/") {
+		return deleted, app.Backend.RemoveDir(bucket, key)
+	}
+
+	idx, err := readObjectIndex(app, bucket, key)
+	if err != nil {
+		return deleted, err
+	}
+	before := S.IndexUsage(idx)
+
+	if len(versionID) == 0 {
+		status := bucketVersioning(app, bucket)
+		if len(status) == 0 {
+			if latest := idx.Latest(); latest != nil && latest.Locked(bypassGovernance, time.Now()) {
+				return deleted, errObjectLocked
+			}
+			if err := app.Backend.RemoveObject(bucket, key, ""); err != nil {
+				return deleted, err
+			}
+			idx.Versions = nil
+			return deleted, commitObjectIndex(app, bucket, idx, before)
+		}
+
+		id, _, err := archiveLatest(app, bucket, idx, status, bypassGovernance)
+		if err != nil {
+			return deleted, err
+		}
+		if err := app.Backend.RemoveObject(bucket, key, ""); err != nil {
+			return deleted, err
+		}
+		idx.Versions = append([]S.ObjectMeta{{VersionID: id, DeleteMarker: true, LastModified: time.Now().UTC()}}, idx.Versions...)
+
+		deleted.DeleteMarker = true
+		deleted.DeleteMarkerVersionID = id
+		return deleted, commitObjectIndex(app, bucket, idx, before)
+	}
+
+	deleted.VersionID = versionID
+	i := idx.Find(versionID)
+	if i < 0 {
+		return deleted, nil
+	}
+
+	version := idx.Versions[i]
+	if version.Locked(bypassGovernance, time.Now()) {
+		return deleted, errObjectLocked
+	}
+	if !version.DeleteMarker {
+		if err := app.Backend.RemoveObject(bucket, key, dataVersion(idx, i)); err != nil {
+			return deleted, err
+		}
+	}
+	idx.Versions = append(idx.Versions[:i], idx.Versions[i+1:]...)
+
+	// the next version becomes the latest
+	if i == 0 && len(idx.Versions) > 0 && !idx.Versions[0].DeleteMarker {
+		if err := app.Backend.RestoreObject(bucket, key, idx.Versions[0].VersionID); err != nil {
+			return deleted, err
+		}
+	}
+
+	if version.DeleteMarker {
+		deleted.DeleteMarker = true
+		deleted.DeleteMarkerVersionID = versionID
+	}
+	return deleted, commitObjectIndex(app, bucket, idx, before)
+}
+
+// updateObjectMeta applies update to a version of a key, the latest
+// version if versionID is empty. Delete markers can not be updated.
+func updateObjectMeta(app *S.App, bucket string, key string, versionID string, update func(*S.ObjectMeta) error) error {
+	unlock := app.Locks.Lock(bucket, key)
+	defer unlock()
+
+	idx, i, err := lookupVersion(app, bucket, key, versionID)
+	if err != nil {
+		return err
+	}
+	if idx.Versions[i].DeleteMarker {
+		return errNoSuchKey
+	}
+	if err := update(&idx.Versions[i]); err != nil {
+		return err
+	}
+	return app.Backend.WriteObjectIndex(bucket, idx)
+}
+
+// userMetadata returns the x-amz-meta-* headers of a request.
+func userMetadata(header http.Header) map[string]string {
+	metadata := make(map[string]string)
+	for k, v := range header {
+		if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+			metadata[http.CanonicalHeaderKey(k)] = strings.Join(v, ",")
+		}
+	}
+	return metadata
+}
+
+// objectHeaders returns the response headers describing a version.
+func objectHeaders(meta *S.ObjectMeta, versioned bool) map[string]string {
+	headers := make(map[string]string)
+	headers["Content-Length"] = fmt.Sprintf("%v", meta.Size)
+	headers["Last-Modified"] = meta.LastModified.UTC().Format(RFC822Format)
+	headers["ETag"] = meta.ETag
+	if len(meta.ContentType) > 0 {
+		headers["Content-Type"] = meta.ContentType
+	}
+	for k, v := range meta.UserMetadata {
+		headers[k] = v
+	}
+	if versioned {
+		headers["X-Amz-Version-Id"] = meta.VersionID
+	}
+	encryptionHeaders(meta, headers)
+	if len(meta.WebsiteRedirectLocation) > 0 {
+		headers["X-Amz-Website-Redirect-Location"] = meta.WebsiteRedirectLocation
+	}
+	if len(meta.Tags) > 0 {
+		headers["X-Amz-Tagging-Count"] = fmt.Sprint(len(meta.Tags))
+	}
+	if len(meta.ReplicationStatus) > 0 {
+		headers["X-Amz-Replication-Status"] = meta.ReplicationStatus
+	}
+	lockHeaders(meta, headers)
+	return headers
+}
@@ -0,0 +1,214 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	S "github.com/autovia/s3-go/structs"
+)
+
+func GetBucketWebsite(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#GetBucketWebsite: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var config S.WebsiteConfiguration
+	found, err := readBucketConfig(app, r.Bucket, "website", &config)
+	if err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+	if !found {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchWebsiteConfiguration", errors.New("website configuration does not exist"), r.Bucket)
+	}
+
+	return app.RespondXML(w, http.StatusOK, config)
+}
+
+func PutBucketWebsite(app *S.App, w http.ResponseWriter, r *S.Request, req *http.Request) error {
+	log.Printf("#PutBucketWebsite: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	var config S.WebsiteConfiguration
+	if err := decodeXMLBody(req, &config); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "MalformedXML", err, r.Bucket)
+	}
+	if err := config.Validate(); err != nil {
+		return app.RespondError(w, http.StatusBadRequest, "InvalidArgument", err, r.Bucket)
+	}
+
+	if err := writeBucketConfig(app, r.Bucket, "website", config); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusOK, nil, nil)
+}
+
+func DeleteBucketWebsite(app *S.App, w http.ResponseWriter, r *S.Request) error {
+	log.Printf("#DeleteBucketWebsite: %v\n", r)
+
+	if _, err := app.Backend.HeadBucket(r.Bucket); errors.Is(err, fs.ErrNotExist) {
+		return app.RespondError(w, http.StatusNotFound, "NoSuchBucket", err, r.Bucket)
+	}
+
+	if err := deleteBucketConfig(app, r.Bucket, "website"); err != nil {
+		return app.RespondError(w, http.StatusInternalServerError, "InternalError", err, r.Bucket)
+	}
+
+	return app.Respond(w, http.StatusNoContent, nil, nil)
+}
+
+// Website serves buckets with a website configuration anonymously. The
+// bucket is selected by the Host header, optionally below -website-domain.
+type Website struct {
+	*S.App
+}
+
+func (a Website) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	log.Printf(">>> WEBSITE %s %s%s\n", req.Method, req.Host, req.URL.Path)
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		websiteError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "")
+		return
+	}
+
+	bucket := req.Host
+	if host, _, err := net.SplitHostPort(bucket); err == nil {
+		bucket = host
+	}
+	if a.WebsiteDomain != nil && len(*a.WebsiteDomain) > 0 {
+		bucket = strings.TrimSuffix(bucket, "."+*a.WebsiteDomain)
+	}
+
+	var config S.WebsiteConfiguration
+	var found bool
+	var err error
+	if len(bucket) > 0 && bucket != *a.Metadata && !strings.ContainsAny(bucket, "/\\") {
+		found, err = readBucketConfig(a.App, bucket, "website", &config)
+	}
+	if err != nil {
+		log.Print(err)
+		websiteError(w, http.StatusInternalServerError, "InternalError", bucket)
+		return
+	}
+	if !found {
+		websiteError(w, http.StatusNotFound, "NoSuchWebsiteConfiguration", bucket)
+		return
+	}
+
+	protocol := "http"
+	if req.TLS != nil {
+		protocol = "https"
+	}
+
+	if to := config.RedirectAllRequestsTo; to != nil {
+		if len(to.Protocol) > 0 {
+			protocol = to.Protocol
+		}
+		http.Redirect(w, req, protocol+"://"+to.HostName+req.URL.RequestURI(), http.StatusMovedPermanently)
+		return
+	}
+
+	// keep the trailing slash, it selects the index document
+	key := strings.TrimPrefix(path.Clean("/"+req.URL.Path), "/")
+	if strings.HasSuffix(req.URL.Path, "/") && len(key) > 0 {
+		key += "/"
+	}
+
+	if rule := config.Route(key, 0); rule != nil {
+		location, code := rule.Location(key, req.Host, protocol)
+		http.Redirect(w, req, location, code)
+		return
+	}
+
+	if len(key) == 0 || strings.HasSuffix(key, "/") {
+		key += config.IndexDocument.Suffix
+	}
+
+	if websiteObject(a.App, w, req, bucket, key, http.StatusOK) {
+		return
+	}
+
+	// folders without trailing slash are redirected to their index document
+	if !strings.HasSuffix(key, "/"+config.IndexDocument.Suffix) && key != config.IndexDocument.Suffix {
+		if idx, i, err := lookupVersion(a.App, bucket, key+"/"+config.IndexDocument.Suffix, ""); err == nil && !idx.Versions[i].DeleteMarker {
+			http.Redirect(w, req, "/"+key+"/", http.StatusFound)
+			return
+		}
+	}
+
+	if rule := config.Route(key, http.StatusNotFound); rule != nil {
+		location, code := rule.Location(key, req.Host, protocol)
+		http.Redirect(w, req, location, code)
+		return
+	}
+
+	if config.ErrorDocument != nil && websiteObject(a.App, w, req, bucket, config.ErrorDocument.Key, http.StatusNotFound) {
+		return
+	}
+	websiteError(w, http.StatusNotFound, "NoSuchKey", key)
+}
+
+// websiteRedirectLocation returns the validated x-amz-website-redirect-location header.
+func websiteRedirectLocation(header http.Header) (string, error) {
+	location := header.Get("X-Amz-Website-Redirect-Location")
+	if len(location) > 0 && !strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return "", errors.New("website redirect location must start with /, http:// or https://")
+	}
+	return location, nil
+}
+
+// websiteObject writes the latest version of key with the status code and
+// reports whether the object exists.
+func websiteObject(app *S.App, w http.ResponseWriter, req *http.Request, bucket string, key string, code int) bool {
+	unlock := app.Locks.RLock(bucket, key)
+	idx, i, err := lookupVersion(app, bucket, key, "")
+	if err != nil || idx.Versions[i].DeleteMarker {
+		unlock()
+		return false
+	}
+	meta := &idx.Versions[i]
+
+	if len(meta.WebsiteRedirectLocation) > 0 && code == http.StatusOK {
+		unlock()
+		http.Redirect(w, req, meta.WebsiteRedirectLocation, http.StatusMovedPermanently)
+		return true
+	}
+
+	file, err := openObjectData(app, bucket, idx, i, 0, nil)
+	unlock()
+	if err != nil {
+		return false
+	}
+
+	headers := objectHeaders(meta, false)
+	if req.Method == http.MethodHead {
+		file.Close()
+		app.Respond(w, code, headers, nil)
+		return true
+	}
+	app.RespondFile(w, code, headers, file)
+	return true
+}
+
+func websiteError(w http.ResponseWriter, code int, awscode string, resource string) {
+	status := fmt.Sprintf("%d %s", code, http.StatusText(code))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "<html>\n<head><title>%s</title></head>\n<body>\n<h1>%s</h1>\n<ul>\n<li>Code: %s</li>\n<li>Resource: %s</li>\n</ul>\n</body>\n</html>\n",
+		status, status, awscode, html.EscapeString(resource))
+}
@@ -7,55 +7,65 @@ import (
 	"flag"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"time"
 
-	"github.com/autovia/s3-go/handlers"
-	S "github.com/autovia/s3-go/structs"
+	"github.com/autovia/s3-go/server"
 )
 
 func main() {
-	app := &S.App{}
-	app.Addr = flag.String("addr", ":3000", "TCP address for the server to listen on, in the form host:port")
-	app.AccessKey = flag.String("access-key", "user", "aws_access_key_id")
-	app.SecretKey = flag.String("secret-key", "password", "aws_secret_access_key")
-	app.Mount = flag.String("mount", "./mount", "root directory containing the buckets and files")
-	app.Metadata = flag.String("metadata", ".s3-go", "root directory object storage metadata")
+	var config server.Config
+	addr := flag.String("addr", ":3000", "TCP address for the server to listen on, in the form host:port")
+	flag.StringVar(&config.AccessKey, "access-key", "user", "aws_access_key_id, empty to disable long-term credentials")
+	flag.StringVar(&config.SecretKey, "secret-key", "password", "aws_secret_access_key")
+	flag.StringVar(&config.Mount, "mount", "./mount", "root directory containing the buckets and files")
+	flag.StringVar(&config.Metadata, "metadata", ".s3-go", "root directory object storage metadata")
+	flag.StringVar(&config.Backend, "backend", "fs", "storage backend, fs keeps buckets as directories in -mount, memory keeps everything in memory")
+	flag.StringVar(&config.Layout, "layout", "", "object layout of the fs backend, plain keeps objects as files at their key path, encoded stores any key, empty for the layout of the mount or encoded for new mounts")
+	flag.Int64Var(&config.MaxMemory, "max-memory", 0, "limit of object data in bytes of the memory backend, 0 for no limit")
+	flag.BoolVar(&config.SignatureV2, "sigv2", true, "accept requests signed with AWS Signature Version 2")
+	websiteAddr := flag.String("website-addr", "", "TCP address of the anonymous static website listener, empty to disable")
+	flag.StringVar(&config.WebsiteDomain, "website-domain", "", "domain of website hosts, <bucket>.<domain> serves the bucket")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file, serves HTTPS together with -tls-key")
+	tlsKey := flag.String("tls-key", "", "TLS private key file")
+	flag.StringVar(&config.SSEMasterKey, "sse-master-key", "", "key file wrapping the data keys of encrypted objects, empty to disable encryption")
+	flag.BoolVar(&config.SSECreateMasterKey, "sse-create-master-key", false, "create the -sse-master-key file with a random key if missing, on the first run")
+	flag.StringVar(&config.KMSKeys, "kms-keys", "", "JSON keyring of the local KMS for aws:kms encryption, empty to disable")
+	flag.StringVar(&config.NotificationTargets, "notification-targets", "", "JSON file of webhook targets for bucket event notifications, empty to disable")
+	flag.StringVar(&config.ReplicationTargets, "replication-targets", "", "JSON file of S3 endpoints and directories buckets replicate to, empty to disable")
+	flag.DurationVar(&config.AccessLogInterval, "access-log-interval", 5*time.Minute, "interval of writing buffered access logs into the target buckets")
+	flag.DurationVar(&config.LifecycleInterval, "lifecycle-interval", time.Hour, "interval of applying bucket lifecycle rules, 0 to disable")
+	flag.StringVar(&config.OIDCIssuer, "oidc-issuer", "", "issuer URL of web identity tokens, keys are discovered unless -oidc-jwks is set")
+	flag.StringVar(&config.OIDCJWKS, "oidc-jwks", "", "JWKS file to validate web identity tokens")
+	flag.StringVar(&config.OIDCAudience, "oidc-audience", "", "required audience of web identity tokens, sts.amazonaws.com if empty")
+	flag.StringVar(&config.OIDCPolicies, "oidc-policies", "", "JSON file mapping web identity token claims to policies")
 	flag.Parse()
 
-	// Router
-	app.Router = http.NewServeMux()
-	app.Router.Handle("/", S.Auth{App: app, R: map[string]any{
-		"GET":    handlers.Get,
-		"PUT":    handlers.Put,
-		"POST":   handlers.Post,
-		"DELETE": handlers.Delete,
-		"HEAD":   handlers.Head,
-	}})
-
-	// Check fs folders
-	if _, err := os.Stat(*app.Mount); os.IsNotExist(err) {
-		if err := os.Mkdir(*app.Mount, os.ModePerm); err != nil {
-			log.Fatalf("Can not create storage directoy at %s", *app.Mount)
-		}
-		log.Printf("Storage directory created at %s", *app.Mount)
+	if config.AccessLogInterval <= 0 {
+		log.Fatalf("-access-log-interval must be positive")
 	}
 
-	metadata := filepath.Join(*app.Mount, *app.Metadata)
-	if _, err := os.Stat(metadata); os.IsNotExist(err) {
-		if err := os.Mkdir(metadata, os.ModePerm); err != nil {
-			log.Fatalf("Can not create metadata directoy at %s", *app.Mount)
-		}
-		log.Printf("Metadata directory created at %s", metadata)
+	s3, err := server.New(config)
+	if err != nil {
+		log.Fatalf("Can not start server: %v", err)
+	}
+
+	if len(*websiteAddr) > 0 {
+		go func() {
+			log.Printf("Website listen on %s", *websiteAddr)
+			log.Fatal(http.ListenAndServe(*websiteAddr, s3.Website()))
+		}()
 	}
 
 	// Server
 	srv := &http.Server{
-		Addr:    *app.Addr,
-		Handler: app.Router,
+		Addr:    *addr,
+		Handler: s3,
 		//TLSConfig:    cfg,
 		//TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler), 0),
 	}
-	log.Printf("Listen on %s", *app.Addr)
+	log.Printf("Listen on %s", *addr)
+	if len(*tlsCert) > 0 || len(*tlsKey) > 0 {
+		log.Fatal(srv.ListenAndServeTLS(*tlsCert, *tlsKey))
+	}
 	log.Fatal(srv.ListenAndServe())
 }
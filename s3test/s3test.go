@@ -0,0 +1,78 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+// Package s3test starts s3-go servers for Go tests, in the spirit of
+// net/http/httptest.
+package s3test
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/autovia/s3-go/server"
+	S "github.com/autovia/s3-go/structs"
+)
+
+// Server is an s3-go server listening on a random local port.
+type Server struct {
+	URL       string
+	Region    string
+	AccessKey string
+	SecretKey string
+	S3        *server.Server
+}
+
+// NewServer starts a server keeping its buckets in memory with random
+// credentials. It is shut down in t.Cleanup.
+func NewServer(t testing.TB) *Server {
+	return NewServerConfig(t, server.Config{})
+}
+
+// NewServerConfig starts a server with config. Missing credentials are
+// generated and the fs backend defaults to a temporary mount.
+func NewServerConfig(t testing.TB, config server.Config) *Server {
+	t.Helper()
+	if len(config.AccessKey) == 0 {
+		config.AccessKey = randomHex(t, 10)
+		config.SecretKey = randomHex(t, 20)
+	}
+	if config.Backend == "fs" && len(config.Mount) == 0 {
+		config.Mount = t.TempDir()
+	}
+
+	s3, err := server.New(config)
+	if err != nil {
+		t.Fatalf("can not start s3 server: %v", err)
+	}
+	ts := httptest.NewServer(s3)
+	t.Cleanup(func() {
+		ts.Close()
+		s3.Close()
+	})
+
+	return &Server{
+		URL:       ts.URL,
+		Region:    "us-east-1",
+		AccessKey: config.AccessKey,
+		SecretKey: config.SecretKey,
+		S3:        s3,
+	}
+}
+
+// Sign signs req with the credentials of the server, payload is the request
+// body.
+func (s *Server) Sign(req *http.Request, payload []byte) {
+	S.SignV4(req, S.HexSHA256Hash(payload), s.AccessKey, s.SecretKey, s.Region, time.Now())
+}
+
+func randomHex(t testing.TB, n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,229 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/autovia/s3-go/server"
+)
+
+func request(t *testing.T, s *Server, method string, path string, body []byte) (*http.Response, string) {
+	req, err := http.NewRequest(method, s.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Error(err)
+		return nil, ""
+	}
+	s.Sign(req, body)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return nil, ""
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp, string(b)
+}
+
+func TestNewServer(t *testing.T) {
+	tests := []struct {
+		name   string
+		config server.Config
+	}{
+		{"memory", server.Config{}},
+		{"fs", server.Config{Backend: "fs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServerConfig(t, tt.config)
+
+			if resp, body := request(t, s, "PUT", "/photos", nil); resp.StatusCode != http.StatusOK {
+				t.Fatalf("result was incorrect\ngot: %v %v\n\nwant: %v", resp.StatusCode, body, http.StatusOK)
+			}
+			if resp, body := request(t, s, "PUT", "/photos/a.txt", []byte("hello")); resp.StatusCode != http.StatusOK {
+				t.Fatalf("result was incorrect\ngot: %v %v\n\nwant: %v", resp.StatusCode, body, http.StatusOK)
+			}
+			if resp, body := request(t, s, "GET", "/photos/a.txt", nil); resp.StatusCode != http.StatusOK || body != "hello" {
+				t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v %v", resp.StatusCode, body, http.StatusOK, "hello")
+			}
+
+			req, _ := http.NewRequest("GET", s.URL+"/photos/a.txt", nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", resp.StatusCode, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	const writers, readers, rounds = 8, 8, 25
+
+	for _, backend := range []string{"memory", "fs"} {
+		t.Run(backend, func(t *testing.T) {
+			s := NewServerConfig(t, server.Config{Backend: backend})
+			request(t, s, "PUT", "/photos", nil)
+			request(t, s, "PUT", "/photos?versioning=", []byte("<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>"))
+
+			var wg sync.WaitGroup
+			done := make(chan struct{})
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < rounds; i++ {
+						if i%5 == 4 {
+							if resp, body := request(t, s, "DELETE", "/photos/a.txt", nil); resp != nil && resp.StatusCode != http.StatusOK {
+								t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", resp.StatusCode, body, http.StatusOK)
+							}
+							continue
+						}
+						data := []byte(strings.Repeat(fmt.Sprintf("%d-%d ", w, i), 1000*(w+1)))
+						if resp, body := request(t, s, "PUT", "/photos/a.txt", data); resp != nil && resp.StatusCode != http.StatusOK {
+							t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", resp.StatusCode, body, http.StatusOK)
+						}
+
+						// a write is visible to the writer right away
+						own := fmt.Sprintf("/photos/%d.txt", w)
+						request(t, s, "PUT", own, data)
+						if resp, body := request(t, s, "GET", own, nil); resp != nil && body != string(data) {
+							t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", resp.StatusCode, len(body), len(data))
+						}
+					}
+				}(w)
+			}
+
+			// readers see complete versions matching their metadata
+			var readersWg sync.WaitGroup
+			for r := 0; r < readers; r++ {
+				readersWg.Add(1)
+				go func() {
+					defer readersWg.Done()
+					for {
+						select {
+						case <-done:
+							return
+						default:
+						}
+						resp, body := request(t, s, "GET", "/photos/a.txt", nil)
+						if resp == nil || resp.StatusCode == http.StatusNotFound {
+							continue
+						}
+						etag := fmt.Sprintf("\"%x\"", md5.Sum([]byte(body)))
+						if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != etag {
+							t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v %v", resp.StatusCode, resp.Header.Get("ETag"), http.StatusOK, etag)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			close(done)
+			readersWg.Wait()
+
+			// no version was lost
+			_, body := request(t, s, "GET", "/photos?versions=&prefix=a.txt", nil)
+			got := strings.Count(body, "<Version>") + strings.Count(body, "<DeleteMarker>")
+			if got != writers*rounds {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", got, writers*rounds)
+			}
+		})
+	}
+}
+
+func TestConcurrentQuota(t *testing.T) {
+	const uploads, size, maxBytes = 16, 6 << 20, 10 << 20
+
+	for _, backend := range []string{"memory", "fs"} {
+		t.Run(backend, func(t *testing.T) {
+			s := NewServerConfig(t, server.Config{Backend: backend})
+			request(t, s, "PUT", "/photos", nil)
+			request(t, s, "PUT", "/photos?quota=", []byte(fmt.Sprintf("<BucketQuota><MaxBytes>%d</MaxBytes></BucketQuota>", maxBytes)))
+
+			var wg sync.WaitGroup
+			for i := 0; i < uploads; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					request(t, s, "PUT", fmt.Sprintf("/photos/%d.txt", i), bytes.Repeat([]byte("x"), size))
+				}(i)
+			}
+			wg.Wait()
+
+			// only one upload fits, however many passed the first check
+			_, body := request(t, s, "GET", "/photos?versions=", nil)
+			if got := strings.Count(body, "<Version>"); got != 1 {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", got, 1)
+			}
+		})
+	}
+}
+
+func TestObjectAndPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		config server.Config
+		want   int
+	}{
+		{"memory", server.Config{}, http.StatusOK},
+		{"fs-encoded", server.Config{Backend: "fs", Layout: "encoded"}, http.StatusOK},
+		{"fs-plain", server.Config{Backend: "fs", Layout: "plain"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServerConfig(t, tt.config)
+			request(t, s, "PUT", "/photos", nil)
+			if resp, body := request(t, s, "PUT", "/photos/a/b", []byte("b")); resp.StatusCode != http.StatusOK {
+				t.Fatalf("result was incorrect\ngot: %v %v\n\nwant: %v", resp.StatusCode, body, http.StatusOK)
+			}
+			if resp, body := request(t, s, "PUT", "/photos/a", []byte("a")); resp.StatusCode != tt.want {
+				t.Fatalf("result was incorrect\ngot: %v %v\n\nwant: %v", resp.StatusCode, body, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			for _, key := range []string{"a", "a/b"} {
+				if _, body := request(t, s, "GET", "/photos/"+key, nil); body != key[len(key)-1:] {
+					t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", body, key[len(key)-1:])
+				}
+			}
+		})
+	}
+}
+
+func TestKeyRoundTrip(t *testing.T) {
+	keys := []string{"a//b", "a/../c", "../d", "./e", "100% + ü?x=1#y", strings.Repeat("k", 1024)}
+	for _, backend := range []string{"memory", "fs"} {
+		t.Run(backend, func(t *testing.T) {
+			s := NewServerConfig(t, server.Config{Backend: backend})
+			request(t, s, "PUT", "/photos", nil)
+
+			for _, key := range keys {
+				path := (&url.URL{Path: "/photos/" + key}).EscapedPath()
+				if resp, body := request(t, s, "PUT", path, []byte(key)); resp.StatusCode != http.StatusOK {
+					t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", resp.StatusCode, body, http.StatusOK)
+				}
+				if resp, body := request(t, s, "GET", path, nil); resp.StatusCode != http.StatusOK || body != key {
+					t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", resp.StatusCode, body, key)
+				}
+			}
+
+			path := (&url.URL{Path: "/photos/" + strings.Repeat("k", 1025)}).EscapedPath()
+			if resp, body := request(t, s, "PUT", path, nil); resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "KeyTooLongError") {
+				t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", resp.StatusCode, body, "KeyTooLongError")
+			}
+		})
+	}
+}
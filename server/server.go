@@ -0,0 +1,198 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+// Package server wires the S3 handlers, the storage backend and the
+// background workers into an http.Handler, so s3-go can be embedded into
+// other programs and tests.
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/autovia/s3-go/handlers"
+	S "github.com/autovia/s3-go/structs"
+)
+
+// Config holds the settings of the command line flags, empty files disable
+// the feature. The zero value differs from the flag defaults: SignatureV2
+// is off, Backend is memory, the credentials are empty and lifecycle
+// rules are not applied. Metadata and AccessLogInterval default as their
+// flags do.
+type Config struct {
+	// AccessKey and SecretKey are the long-term credentials, an empty
+	// AccessKey disables them
+	AccessKey   string
+	SecretKey   string
+	SignatureV2 bool
+
+	// Backend is fs, which keeps buckets as directories in Mount, or
+	// memory, which is the default. Layout is the object layout of the fs
+	// backend, empty for the layout recorded in Mount
+	Backend   string
+	Mount     string
+	Metadata  string
+	Layout    string
+	MaxMemory int64
+
+	WebsiteDomain string
+
+	// SSEMasterKey is only created if missing with SSECreateMasterKey
+	SSEMasterKey        string
+	SSECreateMasterKey  bool
+	KMSKeys             string
+	NotificationTargets string
+	ReplicationTargets  string
+
+	// AccessLogInterval defaults to 5 minutes, a LifecycleInterval of 0
+	// disables lifecycle rules
+	AccessLogInterval time.Duration
+	LifecycleInterval time.Duration
+
+	OIDCIssuer   string
+	OIDCJWKS     string
+	OIDCAudience string
+	OIDCPolicies string
+}
+
+// Server serves the S3 API and runs the background workers until it is
+// closed.
+type Server struct {
+	App     *S.App
+	handler http.Handler
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+func New(config Config) (*Server, error) {
+	if len(config.Metadata) == 0 {
+		config.Metadata = ".s3-go"
+	}
+	if config.AccessLogInterval == 0 {
+		config.AccessLogInterval = 5 * time.Minute
+	}
+	if config.AccessLogInterval < 0 || config.LifecycleInterval < 0 {
+		return nil, fmt.Errorf("intervals must not be negative")
+	}
+
+	app := &S.App{
+		AccessKey:        &config.AccessKey,
+		SecretKey:        &config.SecretKey,
+		Mount:            &config.Mount,
+		Metadata:         &config.Metadata,
+		SignatureV2:      &config.SignatureV2,
+		WebsiteDomain:    &config.WebsiteDomain,
+		Credentials:      S.NewCredentialStore(),
+		Events:           S.NewEventHub(),
+		NotificationWake: make(chan struct{}, 1),
+		ReplicationWake:  make(chan struct{}, 1),
+	}
+
+	switch config.Backend {
+	case "fs":
+		store, err := S.NewFileBackend(config.Mount, config.Metadata, config.Layout)
+		if err != nil {
+			return nil, fmt.Errorf("can not open storage directory at %s: %v", config.Mount, err)
+		}
+		app.Backend = store
+	case "memory", "":
+		app.Backend = S.NewMemoryBackend(config.MaxMemory)
+	default:
+		return nil, fmt.Errorf("unknown backend %s", config.Backend)
+	}
+
+	if len(config.SSEMasterKey) > 0 {
+		key, err := S.LoadMasterKey(config.SSEMasterKey, config.SSECreateMasterKey)
+		if err != nil {
+			return nil, fmt.Errorf("can not load master key: %v", err)
+		}
+		app.MasterKey = key
+	}
+
+	if len(config.KMSKeys) > 0 {
+		keyring, err := S.LoadKeyring(config.KMSKeys)
+		if err != nil {
+			return nil, fmt.Errorf("can not load KMS keyring: %v", err)
+		}
+		app.KMS = keyring
+	}
+
+	if len(config.NotificationTargets) > 0 {
+		targets, err := S.LoadWebhookTargets(config.NotificationTargets)
+		if err != nil {
+			return nil, fmt.Errorf("can not load notification targets: %v", err)
+		}
+		app.Webhooks = targets
+	}
+
+	if len(config.ReplicationTargets) > 0 {
+		targets, err := S.LoadReplicationTargets(config.ReplicationTargets)
+		if err != nil {
+			return nil, fmt.Errorf("can not load replication targets: %v", err)
+		}
+		app.Replication = targets
+	}
+
+	if len(config.OIDCIssuer) > 0 || len(config.OIDCJWKS) > 0 {
+		provider, err := S.NewOIDCProvider(config.OIDCIssuer, config.OIDCAudience, config.OIDCJWKS, config.OIDCPolicies)
+		if err != nil {
+			return nil, fmt.Errorf("can not configure web identity provider: %v", err)
+		}
+		app.OIDC = provider
+	}
+
+	// Router, not a ServeMux which would redirect keys containing // or ..
+	app.Router = handlers.AccessLog{App: app, Next: handlers.CORS{App: app, Next: S.Auth{App: app, R: map[string]any{
+		"GET":     handlers.Get,
+		"PUT":     handlers.Put,
+		"POST":    handlers.Post,
+		"DELETE":  handlers.Delete,
+		"HEAD":    handlers.Head,
+		"OPTIONS": handlers.Options,
+	}}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{App: app, handler: app.Router, cancel: cancel}
+
+	s.run(func() { handlers.AccessLogWorker(ctx, app, config.AccessLogInterval) })
+	if config.LifecycleInterval > 0 {
+		s.run(func() { handlers.LifecycleWorker(ctx, app, config.LifecycleInterval) })
+	}
+	if len(app.Webhooks) > 0 {
+		s.run(func() { handlers.NotificationWorker(ctx, app, 10*time.Second) })
+	}
+	if len(app.Replication) > 0 {
+		s.run(func() { handlers.ReplicationWorker(ctx, app, 10*time.Second) })
+	}
+
+	return s, nil
+}
+
+func (s *Server) run(worker func()) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		worker()
+	}()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.handler.ServeHTTP(w, req)
+}
+
+// Website returns the anonymous handler serving buckets with a website
+// configuration by Host header.
+func (s *Server) Website() http.Handler {
+	return handlers.Website{App: s.App}
+}
+
+// Close stops the background workers after buffered access logs were
+// written. Requests still in flight are not waited for.
+func (s *Server) Close() error {
+	s.cancel()
+	s.workers.Wait()
+	return nil
+}
@@ -0,0 +1,283 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogWriter records what was sent for the access log.
+type AccessLogWriter struct {
+	http.ResponseWriter
+	Status     int
+	Bytes      int64
+	ErrorCode  string
+	HeaderTime time.Time
+}
+
+func (w *AccessLogWriter) WriteHeader(code int) {
+	if w.Status == 0 {
+		w.Status = code
+		w.HeaderTime = time.Now()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *AccessLogWriter) Write(b []byte) (int, error) {
+	if w.Status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.Bytes += int64(n)
+	return n, err
+}
+
+func (w *AccessLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// AccessLogBuffer collects the records of each target until they are
+// written as a log object.
+type AccessLogBuffer struct {
+	mu      sync.Mutex
+	records map[LoggingEnabled][]string
+}
+
+func (b *AccessLogBuffer) Add(target LoggingEnabled, record string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.records == nil {
+		b.records = make(map[LoggingEnabled][]string)
+	}
+	b.records[target] = append(b.records[target], record)
+}
+
+// Take returns the buffered records and empties the buffer.
+func (b *AccessLogBuffer) Take() map[LoggingEnabled][]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	records := b.records
+	b.records = nil
+	return records
+}
+
+// AccessLogRecord is a line of the S3 server access log format, empty
+// fields are written as -.
+type AccessLogRecord struct {
+	BucketOwner    string
+	Bucket         string
+	Time           time.Time
+	RemoteIP       string
+	Requester      string
+	RequestID      string
+	Operation      string
+	Key            string
+	RequestURI     string
+	Status         int
+	ErrorCode      string
+	BytesSent      int64
+	ObjectSize     int64
+	TotalTime      time.Duration
+	TurnAroundTime time.Duration
+	Referer        string
+	UserAgent      string
+	VersionID      string
+	SignatureVer   string
+	CipherSuite    string
+	AuthType       string
+	HostHeader     string
+	TLSVersion     string
+}
+
+func (r *AccessLogRecord) String() string {
+	field := func(s string) string {
+		if len(s) == 0 {
+			return "-"
+		}
+		return s
+	}
+	quoted := func(s string) string {
+		if len(s) == 0 {
+			return "-"
+		}
+		return "\"" + strings.ReplaceAll(s, "\"", "\\\"") + "\""
+	}
+	number := func(n int64) string {
+		if n <= 0 {
+			return "-"
+		}
+		return fmt.Sprint(n)
+	}
+
+	return strings.Join([]string{
+		field(r.BucketOwner),
+		field(r.Bucket),
+		r.Time.UTC().Format("[02/Jan/2006:15:04:05 -0700]"),
+		field(r.RemoteIP),
+		field(r.Requester),
+		field(r.RequestID),
+		field(r.Operation),
+		field(r.Key),
+		quoted(r.RequestURI),
+		number(int64(r.Status)),
+		field(r.ErrorCode),
+		number(r.BytesSent),
+		number(r.ObjectSize),
+		fmt.Sprint(r.TotalTime.Milliseconds()),
+		fmt.Sprint(r.TurnAroundTime.Milliseconds()),
+		quoted(r.Referer),
+		quoted(r.UserAgent),
+		field(r.VersionID),
+		"-",
+		field(r.SignatureVer),
+		field(r.CipherSuite),
+		field(r.AuthType),
+		field(r.HostHeader),
+		field(r.TLSVersion),
+		"-",
+		"-",
+	}, " ")
+}
+
+// logSubresources names the resource of the operation for subresource
+// requests on buckets and objects.
+var logSubresources = []struct {
+	query  string
+	bucket string
+	object string
+}{
+	{"versioning", "VERSIONING", "VERSIONING"},
+	{"versions", "BUCKETVERSIONS", "BUCKETVERSIONS"},
+	{"cors", "CORS", "CORS"},
+	{"encryption", "ENCRYPTION", "ENCRYPTION"},
+	{"events", "EVENTS", "EVENTS"},
+	{"lifecycle", "LIFECYCLE", "LIFECYCLE"},
+	{"logging", "LOGGING_STATUS", "LOGGING_STATUS"},
+	{"notification", "NOTIFICATION", "NOTIFICATION"},
+	{"replication", "REPLICATION", "REPLICATION"},
+	{"object-lock", "OBJECT_LOCK_CONFIGURATION", "OBJECT_LOCK_CONFIGURATION"},
+	{"website", "WEBSITE", "WEBSITE"},
+	{"tagging", "TAGGING", "OBJECT_TAGGING"},
+	{"retention", "RETENTION", "RETENTION"},
+	{"legal-hold", "LEGAL_HOLD", "LEGAL_HOLD"},
+	{"uploads", "UPLOADS", "UPLOADS"},
+	{"delete", "MULTI_OBJECT_DELETE", "MULTI_OBJECT_DELETE"},
+}
+
+// LogOperation returns the operation of a request like REST.GET.OBJECT.
+func LogOperation(r *http.Request) string {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	switch {
+	case IsPreflight(r):
+		return "REST.OPTIONS.PREFLIGHT"
+	case IsPostObject(r):
+		return "REST.POST.OBJECT"
+	case r.Method == http.MethodPut && len(key) > 0 && len(r.Header.Get("X-Amz-Copy-Source")) > 0:
+		return "REST.COPY.OBJECT"
+	}
+
+	resource := "OBJECT"
+	if len(bucket) == 0 {
+		resource = "SERVICE"
+	} else if len(key) == 0 {
+		resource = "BUCKET"
+	}
+
+	query := r.URL.Query()
+	for _, s := range logSubresources {
+		if query.Has(s.query) {
+			resource = s.bucket
+			if len(key) > 0 {
+				resource = s.object
+			}
+			break
+		}
+	}
+	return "REST." + r.Method + "." + resource
+}
+
+// NewAccessLogRecord creates the record of a completed request.
+func NewAccessLogRecord(app *App, r *http.Request, w *AccessLogWriter, requestID string, start time.Time, end time.Time) AccessLogRecord {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if k, err := url.PathUnescape(key); err == nil {
+		key = k
+	}
+
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+
+	record := AccessLogRecord{
+		Bucket:         bucket,
+		Time:           start,
+		RemoteIP:       remoteIP,
+		RequestID:      requestID,
+		Operation:      LogOperation(r),
+		Key:            strings.ReplaceAll(url.QueryEscape(key), "%2F", "/"),
+		RequestURI:     r.Method + " " + r.URL.RequestURI() + " " + r.Proto,
+		Status:         w.Status,
+		ErrorCode:      w.ErrorCode,
+		BytesSent:      w.Bytes,
+		TotalTime:      end.Sub(start),
+		Referer:        r.Referer(),
+		UserAgent:      r.UserAgent(),
+		VersionID:      r.URL.Query().Get("versionId"),
+		HostHeader:     r.Host,
+		TurnAroundTime: end.Sub(start),
+	}
+	if !w.HeaderTime.IsZero() {
+		record.TurnAroundTime = w.HeaderTime.Sub(start)
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if len(key) > 0 && len(r.URL.RawQuery) == 0 {
+			record.ObjectSize = r.ContentLength
+		}
+	case http.MethodGet, http.MethodHead:
+		if _, size, ok := strings.Cut(w.Header().Get("Content-Range"), "/"); ok {
+			fmt.Sscan(size, &record.ObjectSize)
+		} else if len(key) > 0 {
+			fmt.Sscan(w.Header().Get("Content-Length"), &record.ObjectSize)
+		}
+	}
+
+	// the requester is only known for accepted signatures
+	authorization := r.Header.Get("Authorization")
+	accessKey := ""
+	switch {
+	case strings.HasPrefix(authorization, "AWS4-HMAC-SHA256"):
+		record.SignatureVer, record.AuthType = "SigV4", "AuthHeader"
+		_, credential, _ := strings.Cut(authorization, "Credential=")
+		accessKey, _, _ = strings.Cut(credential, "/")
+	case strings.HasPrefix(authorization, "AWS "):
+		record.SignatureVer, record.AuthType = "SigV2", "AuthHeader"
+		accessKey, _, _ = strings.Cut(strings.TrimPrefix(authorization, "AWS "), ":")
+	case IsSignatureV2(r):
+		record.SignatureVer, record.AuthType = "SigV2", "QueryString"
+		accessKey = r.URL.Query().Get("AWSAccessKeyId")
+	}
+	if w.Status != http.StatusUnauthorized {
+		if c, ok := app.LookupCredentials(accessKey, r.Header.Get("X-Amz-Security-Token")); ok {
+			record.Requester = c.Arn
+		}
+	}
+
+	if r.TLS != nil {
+		record.CipherSuite = tls.CipherSuiteName(r.TLS.CipherSuite)
+		record.TLSVersion = strings.Replace(tls.VersionName(r.TLS.Version), "TLS ", "TLSv", 1)
+	}
+	return record
+}
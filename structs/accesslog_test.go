@@ -0,0 +1,71 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogOperation(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		header map[string]string
+		want   string
+	}{
+		{"GET", "/", nil, "REST.GET.SERVICE"},
+		{"GET", "/bucket", nil, "REST.GET.BUCKET"},
+		{"GET", "/bucket/key", nil, "REST.GET.OBJECT"},
+		{"HEAD", "/bucket/key", nil, "REST.HEAD.OBJECT"},
+		{"PUT", "/bucket/key", map[string]string{"X-Amz-Copy-Source": "/bucket/other"}, "REST.COPY.OBJECT"},
+		{"GET", "/bucket?tagging", nil, "REST.GET.TAGGING"},
+		{"PUT", "/bucket/key?tagging", nil, "REST.PUT.OBJECT_TAGGING"},
+		{"GET", "/bucket?versions", nil, "REST.GET.BUCKETVERSIONS"},
+		{"POST", "/bucket?delete", nil, "REST.POST.MULTI_OBJECT_DELETE"},
+		{"POST", "/bucket", map[string]string{"Content-Type": "multipart/form-data; boundary=x"}, "REST.POST.OBJECT"},
+		{"OPTIONS", "/bucket/key", nil, "REST.OPTIONS.PREFLIGHT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			if got := LogOperation(r); got != tt.want {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessLogRecord(t *testing.T) {
+	accessKey, secretKey := "user", "password"
+	app := &App{AccessKey: &accessKey, SecretKey: &secretKey}
+
+	r := httptest.NewRequest("GET", "/bucket/a%20b/c.txt?versionId=v1", nil)
+	r.RemoteAddr = "192.0.2.3:50000"
+	r.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=user/20240501/us-east-1/s3/aws4_request, SignedHeaders=host, Signature=abc")
+	r.Header.Set("User-Agent", "curl/8.0")
+
+	w := &AccessLogWriter{ResponseWriter: httptest.NewRecorder()}
+	w.Header().Set("Content-Length", "5")
+	w.Write([]byte("hello"))
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	record := NewAccessLogRecord(app, r, w, "ABC123", start, start.Add(25*time.Millisecond))
+	want := `- bucket [01/May/2024:12:00:00 +0000] 192.0.2.3 arn:aws:iam::000000000000:root ABC123 REST.GET.OBJECT a+b/c.txt "GET /bucket/a%20b/c.txt?versionId=v1 HTTP/1.1" 200 - 5 5 25 `
+	if got := record.String(); !strings.HasPrefix(got, want) || !strings.Contains(got, `"curl/8.0" v1 - SigV4 - AuthHeader example.com -`) {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v...", got, want)
+	}
+
+	w = &AccessLogWriter{ResponseWriter: httptest.NewRecorder()}
+	app.RespondError(w, http.StatusNotFound, "NoSuchKey", nil, "key")
+	if w.Status != http.StatusNotFound || w.ErrorCode != "NoSuchKey" {
+		t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v %v", w.Status, w.ErrorCode, http.StatusNotFound, "NoSuchKey")
+	}
+}
@@ -5,13 +5,40 @@ package structs
 
 import (
 	"net/http"
+	"sync"
 )
 
 type App struct {
-	Addr      *string
-	Router    *http.ServeMux
+	Router    http.Handler
 	AccessKey *string
 	SecretKey *string
 	Mount     *string
 	Metadata  *string
+	Backend   Backend
+	Locks     KeyLocks
+
+	// UsageMu serializes updates of the bucket usage counters, QuotaLocks
+	// the commits into buckets with a quota. The lock of a bucket is taken
+	// while holding the lock of the key.
+	UsageMu    sync.Mutex
+	QuotaLocks KeyLocks
+
+	SignatureV2 *bool
+
+	WebsiteDomain *string
+
+	MasterKey []byte
+	KMS       *Keyring
+
+	Webhooks    map[string]*WebhookTarget
+	Events      *EventHub
+	Replication map[string]*ReplicationTarget
+	AccessLogs  AccessLogBuffer
+
+	// wake the workers when work was queued
+	NotificationWake chan struct{}
+	ReplicationWake  chan struct{}
+
+	Credentials *CredentialStore
+	OIDC        *OIDCProvider
 }
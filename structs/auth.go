@@ -6,7 +6,10 @@ package structs
 import (
 	"errors"
 	"log"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type Auth struct {
@@ -15,7 +18,7 @@ type Auth struct {
 }
 
 func (a Auth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	log.Printf("AuthHandler %v\n%v", r, a.R)
+	log.Printf("AuthHandler %s %s%s\n", r.Method, r.Host, r.URL.Path)
 
 	if _, ok := a.R[r.Method]; !ok {
 		log.Print("http method not allowed")
@@ -23,16 +26,70 @@ func (a Auth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	valid, req := a.ValidSignatureV4(r)
+	// browser form uploads carry their signature in the policy fields,
+	// web identity tokens are validated by the STS handler and browsers
+	// send CORS preflight requests without credentials
+	valid, req := true, r
+	switch {
+	case IsPostObject(r), IsWebIdentityRequest(r), IsPreflight(r):
+	case IsSignatureV2(r):
+		valid = a.SignatureV2 != nil && *a.SignatureV2
+		if valid {
+			valid, req = a.ValidSignatureV2(r)
+		}
+		if valid {
+			if err := CheckRequestTimeV2(r, time.Now()); errors.Is(err, ErrRequestTimeTooSkewed) {
+				log.Print(err)
+				a.RespondError(w, 403, "RequestTimeTooSkewed", err, "")
+				return
+			} else if err != nil {
+				log.Print(err)
+				valid = false
+			}
+		}
+	default:
+		valid, req = a.ValidSignatureV4(r)
+	}
 	if !valid {
 		log.Print("signature not valid")
 		a.RespondError(w, 401, "UnauthorizedAccess", errors.New("UnauthorizedAccess"), "")
 		return
 	}
 
+	// session policies of temporary credentials, STS requests are checked by the handler
+	if c := RequestCredentials(req); c != nil && req.URL.Path != "/" {
+		action, resource := RequestAction(req)
+		if !c.IsAllowed(action, resource) {
+			log.Printf("%s not allowed on %s", action, resource)
+			a.RespondError(w, 403, "AccessDenied", errors.New("AccessDenied"), resource)
+			return
+		}
+	}
+
 	err := a.R[req.Method].(func(e *App, w http.ResponseWriter, r *http.Request) error)(a.App, w, req)
 	if err != nil {
 		log.Print(err)
 		return
 	}
 }
+
+// IsPostObject reports whether r is a browser form upload, a POST to the
+// bucket without a key or subresource. Only those skip the signature check.
+func IsPostObject(r *http.Request) bool {
+	if r.Method != http.MethodPost || len(r.URL.RawQuery) > 0 {
+		return false
+	}
+	bucket := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(bucket) == 0 || strings.Contains(bucket, "/") {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+func IsWebIdentityRequest(r *http.Request) bool {
+	if r.Method != http.MethodPost || r.URL.Path != "/" || len(r.Header.Get("Authorization")) > 0 {
+		return false
+	}
+	return r.ParseForm() == nil && r.PostForm.Get("Action") == "AssumeRoleWithWebIdentity"
+}
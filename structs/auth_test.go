@@ -0,0 +1,36 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsPostObject(t *testing.T) {
+	tests := []struct {
+		method      string
+		target      string
+		contentType string
+		want        bool
+	}{
+		{"POST", "/photos", "multipart/form-data; boundary=x", true},
+		{"POST", "/photos/", "multipart/form-data; boundary=x", true},
+		{"POST", "/photos?delete", "multipart/form-data; boundary=x", false},
+		{"POST", "/photos?uploads", "multipart/form-data; boundary=x", false},
+		{"POST", "/photos/a.jpg", "multipart/form-data; boundary=x", false},
+		{"POST", "/", "multipart/form-data; boundary=x", false},
+		{"POST", "/photos", "application/xml", false},
+		{"PUT", "/photos", "multipart/form-data; boundary=x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Header.Set("Content-Type", tt.contentType)
+			if got := IsPostObject(r); got != tt.want {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrBucketNotEmpty = errors.New("bucket is not empty")
+
+// ErrKeyConflict is returned by backends which can not store a key because
+// a part of it is a directory or an object, like the plain file layout.
+var ErrKeyConflict = errors.New("key conflicts with a directory or object")
+
+// Backend stores the buckets, the data of object versions and the metadata
+// of the server. Missing buckets, objects and metadata are reported with
+// errors matching fs.ErrNotExist.
+//
+// The data of the latest version of a key is kept apart from archived
+// noncurrent versions. Object data methods address an archived version by
+// its version ID and the latest version by an empty version ID.
+type Backend interface {
+	ListBuckets() ([]BucketInfo, error)
+	CreateBucket(bucket string) error
+	HeadBucket(bucket string) (BucketInfo, error)
+	// DeleteBucket removes an empty bucket together with its metadata.
+	DeleteBucket(bucket string) error
+
+	// StatObject describes the latest data of a key or a directory.
+	StatObject(bucket string, key string) (ObjectInfo, error)
+	// ListDir returns the objects and directories directly below dir.
+	ListDir(bucket string, dir string) ([]ObjectInfo, error)
+	// ListKeys returns the sorted keys with prefix which have data or a
+	// version index, including keys whose latest version is a delete marker.
+	ListKeys(bucket string, prefix string) ([]string, error)
+	OpenObject(bucket string, key string, versionID string) (io.ReadSeekCloser, error)
+	// CreateObject stages new latest data of a key, readers see the
+	// previous data until the writer is committed.
+	CreateObject(bucket string, key string) (ObjectWriter, error)
+	// ArchiveObject moves the latest data of a key to an archived version.
+	ArchiveObject(bucket string, key string, versionID string) error
+	// RestoreObject moves an archived version back to the latest data.
+	RestoreObject(bucket string, key string, versionID string) error
+	// RemoveObject removes data, missing data is not an error.
+	RemoveObject(bucket string, key string, versionID string) error
+	MakeDir(bucket string, key string) error
+	RemoveDir(bucket string, key string) error
+
+	ReadObjectIndex(bucket string, key string) (*ObjectIndex, error)
+	// WriteObjectIndex replaces the index of a key, an index without
+	// versions removes the key including its archived versions.
+	WriteObjectIndex(bucket string, idx *ObjectIndex) error
+
+	CreateMultipartUpload(uploadID string, key string, meta *ObjectMeta) error
+
+	// Metadata entries are named by slash separated paths like
+	// buckets/<bucket>/versioning.xml. Writes replace entries atomically.
+	ReadMetadata(name string) ([]byte, error)
+	WriteMetadata(name string, b []byte) error
+	// DeleteMetadata removes an entry, a missing entry is not an error.
+	DeleteMetadata(name string) error
+	// ListMetadata returns the sorted names of the entries in dir.
+	ListMetadata(dir string) ([]string, error)
+}
+
+type BucketInfo struct {
+	Name         string
+	CreationDate time.Time
+}
+
+type ObjectInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+// ObjectWriter stages the data written to it. Commit replaces the latest
+// data of the key at once, Abort discards the staged data.
+type ObjectWriter interface {
+	io.Writer
+	Commit() error
+	Abort() error
+}
+
+// listKeyDir returns the entries directly below dir for backends whose
+// directories are implied by the keys of objects and by explicit dirs,
+// both without a trailing slash. A name can be an object and a directory
+// at the same time, the object is listed first.
+func listKeyDir(objects []ObjectInfo, dirs map[string]time.Time, dir string) []ObjectInfo {
+	prefix := strings.TrimSuffix(dir, "/")
+	if len(prefix) > 0 {
+		prefix += "/"
+	}
+
+	entries := []ObjectInfo{}
+	subdirs := make(map[string]bool)
+	addDir := func(path string) {
+		name, _, _ := strings.Cut(strings.TrimPrefix(path, prefix), "/")
+		if !subdirs[name] {
+			subdirs[name] = true
+			entries = append(entries, ObjectInfo{Name: name, ModTime: dirs[prefix+name], IsDir: true})
+		}
+	}
+	for _, o := range objects {
+		if !strings.HasPrefix(o.Name, prefix) {
+			continue
+		}
+		if name := strings.TrimPrefix(o.Name, prefix); !strings.Contains(name, "/") {
+			o.Name = name
+			entries = append(entries, o)
+		} else {
+			addDir(o.Name)
+		}
+	}
+	for d := range dirs {
+		if strings.HasPrefix(d, prefix) {
+			addDir(d)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return !entries[i].IsDir
+	})
+	return entries
+}
@@ -0,0 +1,169 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func testBackends(t *testing.T) map[string]Backend {
+	plain, err := NewFileBackend(t.TempDir(), ".s3-go", LayoutPlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := NewFileBackend(t.TempDir(), ".s3-go", LayoutEncoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Backend{"fs-plain": plain, "fs-encoded": encoded, "memory": NewMemoryBackend(0)}
+}
+
+func writeObject(t *testing.T, b Backend, bucket string, key string, data string) {
+	w, err := b.CreateObject(bucket, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, data)
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readObject(b Backend, bucket string, key string, versionID string) string {
+	r, err := b.OpenObject(bucket, key, versionID)
+	if err != nil {
+		return err.Error()
+	}
+	defer r.Close()
+	data, _ := io.ReadAll(r)
+	return string(data)
+}
+
+func TestBackendVersions(t *testing.T) {
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			testBackendVersions(t, b)
+		})
+	}
+}
+
+func testBackendVersions(t *testing.T, b Backend) {
+	if err := b.CreateBucket("photos"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.CreateBucket("photos"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, fs.ErrExist)
+	}
+
+	writeObject(t, b, "photos", "2023/a.jpg", "first")
+	if err := b.ArchiveObject("photos", "2023/a.jpg", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	writeObject(t, b, "photos", "2023/a.jpg", "second")
+	if got := readObject(b, "photos", "2023/a.jpg", "v1") + " " + readObject(b, "photos", "2023/a.jpg", ""); got != "first second" {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", got, "first second")
+	}
+
+	// a key whose latest version is a delete marker only has an index
+	if err := b.WriteObjectIndex("photos", &ObjectIndex{Key: "b.jpg", Versions: []ObjectMeta{{VersionID: "v2", DeleteMarker: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := b.ListKeys("photos", "")
+	if want := []string{"2023/a.jpg", "b.jpg"}; err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", keys, err, want)
+	}
+	if err := b.DeleteBucket("photos"); !errors.Is(err, ErrBucketNotEmpty) {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, ErrBucketNotEmpty)
+	}
+
+	if err := b.RemoveObject("photos", "2023/a.jpg", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RestoreObject("photos", "2023/a.jpg", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readObject(b, "photos", "2023/a.jpg", ""); got != "first" {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", got, "first")
+	}
+}
+
+func TestBackendMetadata(t *testing.T) {
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			testBackendMetadata(t, b)
+		})
+	}
+}
+
+func testBackendMetadata(t *testing.T, b Backend) {
+	for _, name := range []string{"notifications/2.json", "notifications/1.json"} {
+		if err := b.WriteMetadata(name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.DeleteMetadata("notifications/2.json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DeleteMetadata("notifications/3.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := b.ListMetadata("notifications")
+	if want := []string{"1.json"}; err != nil || !reflect.DeepEqual(names, want) {
+		t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", names, err, want)
+	}
+	if _, err := b.ReadMetadata("notifications/2.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, fs.ErrNotExist)
+	}
+	if names, err := b.ListMetadata("replication"); err != nil || len(names) > 0 {
+		t.Errorf("result was incorrect\ngot: %v %v\n\nwant: []", names, err)
+	}
+}
+
+func TestBackendStagedWrites(t *testing.T) {
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := b.CreateBucket("photos"); err != nil {
+				t.Fatal(err)
+			}
+			writeObject(t, b, "photos", "a.jpg", "old")
+
+			// staged data is invisible until committed
+			w, err := b.CreateObject("photos", "a.jpg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(w, "new")
+			if got := readObject(b, "photos", "a.jpg", ""); got != "old" {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", got, "old")
+			}
+			if err := w.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if got := readObject(b, "photos", "a.jpg", ""); got != "new" {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", got, "new")
+			}
+
+			// aborted data is discarded
+			w, err = b.CreateObject("photos", "b.jpg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(w, "partial")
+			if err := w.Abort(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := b.StatObject("photos", "b.jpg"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, fs.ErrNotExist)
+			}
+			if keys, _ := b.ListKeys("photos", ""); len(keys) != 1 {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", keys, []string{"a.jpg"})
+			}
+		})
+	}
+}
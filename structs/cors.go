@@ -0,0 +1,108 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var corsMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPut:    true,
+	http.MethodPost:   true,
+	http.MethodDelete: true,
+	http.MethodHead:   true,
+}
+
+// IsPreflight reports whether the request is a CORS preflight request,
+// preflight requests are not signed.
+func IsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions
+}
+
+// Validate checks a CORS configuration as S3 does on PUT.
+func (c *CORSConfiguration) Validate() error {
+	if len(c.CORSRules) == 0 {
+		return fmt.Errorf("cors configuration has no rules")
+	}
+	if len(c.CORSRules) > 100 {
+		return fmt.Errorf("cors configuration has more than 100 rules")
+	}
+	for _, rule := range c.CORSRules {
+		if len(rule.AllowedOrigins) == 0 || len(rule.AllowedMethods) == 0 {
+			return fmt.Errorf("cors rule requires AllowedOrigin and AllowedMethod")
+		}
+		for _, m := range rule.AllowedMethods {
+			if !corsMethods[m] {
+				return fmt.Errorf("unsupported method %s", m)
+			}
+		}
+		for _, o := range rule.AllowedOrigins {
+			if strings.Count(o, "*") > 1 {
+				return fmt.Errorf("AllowedOrigin %q can not have more than one wildcard", o)
+			}
+		}
+		for _, h := range rule.AllowedHeaders {
+			if strings.Count(h, "*") > 1 {
+				return fmt.Errorf("AllowedHeader %q can not have more than one wildcard", h)
+			}
+		}
+	}
+	return nil
+}
+
+// Match returns the first rule allowing a request from origin with method
+// and the request headers or nil.
+func (c *CORSConfiguration) Match(origin string, method string, headers []string) *CORSRule {
+	for i, rule := range c.CORSRules {
+		if rule.allows(origin, method, headers) {
+			return &c.CORSRules[i]
+		}
+	}
+	return nil
+}
+
+func (rule *CORSRule) allows(origin string, method string, headers []string) bool {
+	if !matchAny(rule.AllowedOrigins, origin, false) {
+		return false
+	}
+	allowed := false
+	for _, m := range rule.AllowedMethods {
+		if m == method {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return false
+	}
+	for _, h := range headers {
+		if !matchAny(rule.AllowedHeaders, strings.TrimSpace(h), true) {
+			return false
+		}
+	}
+	return true
+}
+
+// Headers returns the Access-Control-* response headers of a matched rule.
+func (rule *CORSRule) Headers(origin string) map[string]string {
+	headers := map[string]string{
+		"Access-Control-Allow-Methods": strings.Join(rule.AllowedMethods, ", "),
+		"Vary":                         "Origin, Access-Control-Request-Headers, Access-Control-Request-Method",
+	}
+	if len(rule.AllowedOrigins) == 1 && rule.AllowedOrigins[0] == "*" {
+		headers["Access-Control-Allow-Origin"] = "*"
+	} else {
+		headers["Access-Control-Allow-Origin"] = origin
+		headers["Access-Control-Allow-Credentials"] = "true"
+	}
+	if len(rule.ExposeHeaders) > 0 {
+		headers["Access-Control-Expose-Headers"] = strings.Join(rule.ExposeHeaders, ", ")
+	}
+	if rule.MaxAgeSeconds > 0 {
+		headers["Access-Control-Max-Age"] = fmt.Sprint(rule.MaxAgeSeconds)
+	}
+	return headers
+}
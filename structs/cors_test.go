@@ -0,0 +1,86 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCORSConfigurationMatch(t *testing.T) {
+	config := CORSConfiguration{CORSRules: []CORSRule{
+		{
+			AllowedOrigins: []string{"https://*.example.com"},
+			AllowedMethods: []string{"GET", "PUT"},
+			AllowedHeaders: []string{"Content-*", "x-amz-*", "Authorization"},
+			ExposeHeaders:  []string{"ETag"},
+			MaxAgeSeconds:  3000,
+		},
+		{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET"},
+		},
+	}}
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		headers []string
+		want    int
+	}{
+		{"origin wildcard", "https://app.example.com", "PUT", nil, 0},
+		{"headers", "https://app.example.com", "PUT", []string{"content-type", " X-Amz-Date", "authorization"}, 0},
+		{"header not allowed", "https://app.example.com", "PUT", []string{"x-custom"}, -1},
+		{"method not allowed", "https://app.example.com", "DELETE", nil, -1},
+		{"any origin", "https://other.org", "GET", nil, 1},
+		{"any origin without headers", "https://other.org", "GET", []string{"x-amz-date"}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := config.Match(tt.origin, tt.method, tt.headers)
+			var want *CORSRule
+			if tt.want >= 0 {
+				want = &config.CORSRules[tt.want]
+			}
+			if result != want {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", result, want)
+			}
+		})
+	}
+
+	t.Run("headers", func(t *testing.T) {
+		result := config.CORSRules[0].Headers("https://app.example.com")
+		expected := map[string]string{
+			"Access-Control-Allow-Origin":      "https://app.example.com",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Allow-Methods":     "GET, PUT",
+			"Access-Control-Expose-Headers":    "ETag",
+			"Access-Control-Max-Age":           "3000",
+			"Vary":                             "Origin, Access-Control-Request-Headers, Access-Control-Request-Method",
+		}
+		if !reflect.DeepEqual(expected, result) {
+			t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", result, expected)
+		}
+	})
+}
+
+func TestCORSConfigurationValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config CORSConfiguration
+	}{
+		{"no rules", CORSConfiguration{}},
+		{"no origin", CORSConfiguration{CORSRules: []CORSRule{{AllowedMethods: []string{"GET"}}}}},
+		{"method", CORSConfiguration{CORSRules: []CORSRule{{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"PATCH"}}}}},
+		{"wildcards", CORSConfiguration{CORSRules: []CORSRule{{AllowedOrigins: []string{"*.*"}, AllowedMethods: []string{"GET"}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); err == nil {
+				t.Error("invalid configuration accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Expiration   time.Time
+	Arn          string
+	Policies     []IAMPolicy
+}
+
+// Temporary reports whether the credentials were issued by the STS endpoint.
+func (c *Credentials) Temporary() bool {
+	return len(c.SessionToken) > 0
+}
+
+// IsAllowed evaluates the policies of the credentials, every policy has to
+// allow the action. Credentials without policies are allowed everything.
+func (c *Credentials) IsAllowed(action string, resource string) bool {
+	for _, p := range c.Policies {
+		if !p.IsAllowed(action, resource) {
+			return false
+		}
+	}
+	return true
+}
+
+type CredentialStore struct {
+	mu          sync.Mutex
+	credentials map[string]*Credentials
+}
+
+func NewCredentialStore() *CredentialStore {
+	return &CredentialStore{credentials: make(map[string]*Credentials)}
+}
+
+// Issue creates temporary credentials valid for duration.
+func (s *CredentialStore) Issue(arn string, duration time.Duration, policies ...IAMPolicy) *Credentials {
+	c := &Credentials{
+		AccessKey:    "ASIA" + randomString(16, "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"),
+		SecretKey:    randomString(40, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"),
+		SessionToken: randomString(128, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"),
+		Expiration:   time.Now().Add(duration).UTC().Truncate(time.Second),
+		Arn:          arn,
+		Policies:     policies,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, v := range s.credentials {
+		if now.After(v.Expiration) {
+			delete(s.credentials, k)
+		}
+	}
+	s.credentials[c.AccessKey] = c
+	return c
+}
+
+func (s *CredentialStore) Get(accessKey string) (*Credentials, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.credentials[accessKey]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(c.Expiration) {
+		delete(s.credentials, accessKey)
+		return nil, false
+	}
+	return c, true
+}
+
+// LookupCredentials resolves an access key to the long-term credentials
+// or to temporary credentials matching the session token.
+func (app *App) LookupCredentials(accessKey string, sessionToken string) (*Credentials, bool) {
+	if len(accessKey) == 0 {
+		return nil, false
+	}
+
+	if accessKey == *app.AccessKey {
+		if len(sessionToken) > 0 {
+			return nil, false
+		}
+		return &Credentials{AccessKey: *app.AccessKey, SecretKey: *app.SecretKey, Arn: "arn:aws:iam::000000000000:root"}, true
+	}
+
+	if app.Credentials == nil {
+		return nil, false
+	}
+	c, ok := app.Credentials.Get(accessKey)
+	if !ok || c.SessionToken != sessionToken {
+		return nil, false
+	}
+	return c, true
+}
+
+type credentialsKey struct{}
+
+// WithCredentials attaches the authenticated credentials to the request.
+func WithCredentials(r *http.Request, c *Credentials) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), credentialsKey{}, c))
+}
+
+// RequestCredentials returns the credentials the request was authenticated with.
+func RequestCredentials(r *http.Request) *Credentials {
+	c, _ := r.Context().Value(credentialsKey{}).(*Credentials)
+	return c
+}
+
+func randomString(n int, alphabet string) string {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(alphabet)))
+	for i := range b {
+		v, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = alphabet[v.Int64()]
+	}
+	return string(b)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// eventBuffer is the number of events a subscriber may fall behind before
+// it is disconnected.
+const eventBuffer = 256
+
+// EventHub fans out bucket events to live subscribers of the events endpoint.
+type EventHub struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]bool
+}
+
+// Subscription receives the matching events of a bucket on C. C is closed
+// when the subscriber fell too far behind.
+type Subscription struct {
+	Bucket string
+	Filter QueueConfiguration
+	C      chan Event
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{subscribers: make(map[*Subscription]bool)}
+}
+
+// ParseEventFilter creates the filter of a subscription from the comma
+// separated event types, all created and removed events if empty.
+func ParseEventFilter(events string, prefix string, suffix string) (QueueConfiguration, error) {
+	filter := QueueConfiguration{Events: []string{"s3:ObjectCreated:*", "s3:ObjectRemoved:*"}}
+	if len(events) > 0 {
+		filter.Events = strings.Split(events, ",")
+	}
+	for _, event := range filter.Events {
+		if !notificationEvents[event] {
+			return filter, fmt.Errorf("unsupported event %s", event)
+		}
+	}
+
+	if len(prefix) > 0 || len(suffix) > 0 {
+		filter.Filter = &NotificationFilter{}
+		if len(prefix) > 0 {
+			filter.Filter.FilterRules = append(filter.Filter.FilterRules, FilterRule{"prefix", prefix})
+		}
+		if len(suffix) > 0 {
+			filter.Filter.FilterRules = append(filter.Filter.FilterRules, FilterRule{"suffix", suffix})
+		}
+	}
+	return filter, nil
+}
+
+func (h *EventHub) Subscribe(bucket string, filter QueueConfiguration) *Subscription {
+	s := &Subscription{Bucket: bucket, Filter: filter, C: make(chan Event, eventBuffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[s] = true
+	return s
+}
+
+func (h *EventHub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[s] {
+		delete(h.subscribers, s)
+		close(s.C)
+	}
+}
+
+// Listening reports whether the bucket has subscribers.
+func (h *EventHub) Listening(bucket string) bool {
+	if h == nil {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subscribers {
+		if s.Bucket == bucket {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish sends event of key to the matching subscribers without blocking.
+func (h *EventHub) Publish(bucket string, event string, key string, record EventRecord) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subscribers {
+		if s.Bucket != bucket || !s.Filter.Matches(event, key) {
+			continue
+		}
+		select {
+		case s.C <- Event{Records: []EventRecord{record}}:
+		default:
+			delete(h.subscribers, s)
+			close(s.C)
+		}
+	}
+}
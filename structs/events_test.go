@@ -0,0 +1,64 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEventFilter(t *testing.T) {
+	tests := []struct {
+		events string
+		valid  bool
+	}{
+		{"", true},
+		{"s3:ObjectCreated:*", true},
+		{"s3:ObjectCreated:Put,s3:ObjectRemoved:Delete", true},
+		{"s3:ObjectRestore:*", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.events, func(t *testing.T) {
+			_, err := ParseEventFilter(tt.events, "", "")
+			if (err == nil) != tt.valid {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestEventHub(t *testing.T) {
+	h := NewEventHub()
+	filter, _ := ParseEventFilter("s3:ObjectCreated:*", "logs/", "")
+	s := h.Subscribe("bucket", filter)
+
+	if !h.Listening("bucket") || h.Listening("other") {
+		t.Errorf("result was incorrect\ngot: %v %v\n\nwant: true false", h.Listening("bucket"), h.Listening("other"))
+	}
+
+	now := time.Now()
+	h.Publish("bucket", "s3:ObjectCreated:Put", "logs/a", NewEventRecord("s3:ObjectCreated:Put", "bucket", "logs/a", nil, "", "", now))
+	h.Publish("bucket", "s3:ObjectCreated:Put", "data/a", NewEventRecord("s3:ObjectCreated:Put", "bucket", "data/a", nil, "", "", now))
+	h.Publish("bucket", "s3:ObjectRemoved:Delete", "logs/a", NewEventRecord("s3:ObjectRemoved:Delete", "bucket", "logs/a", nil, "", "", now))
+	h.Publish("other", "s3:ObjectCreated:Put", "logs/a", NewEventRecord("s3:ObjectCreated:Put", "other", "logs/a", nil, "", "", now))
+	if len(s.C) != 1 {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", len(s.C), 1)
+	}
+
+	// slow subscribers are disconnected
+	for i := 0; i < eventBuffer; i++ {
+		h.Publish("bucket", "s3:ObjectCreated:Put", "logs/a", NewEventRecord("s3:ObjectCreated:Put", "bucket", "logs/a", nil, "", "", now))
+	}
+	if h.Listening("bucket") {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", true, false)
+	}
+	h.Unsubscribe(s)
+	n := 0
+	for range s.C {
+		n++
+	}
+	if n != eventBuffer {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", n, eventBuffer)
+	}
+}
@@ -0,0 +1,680 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Layouts of the objects of a FileBackend.
+const (
+	// LayoutPlain keeps the latest data of a key as a plain file at the key
+	// path, so the mount can be browsed directly. Keys that are a file and
+	// a directory at once and keys longer than the file system allows can
+	// not be stored.
+	LayoutPlain = "plain"
+	// LayoutEncoded keeps the latest data next to the version index of a
+	// key, which is named by the hash of the key, so any key can be stored.
+	LayoutEncoded = "encoded"
+)
+
+// FileBackend keeps buckets as directories below root. The metadata
+// directory in root is laid out as
+//
+//	layout                           layout of the objects, plain or encoded
+//	buckets/<bucket>/<config>.xml    bucket configurations like versioning
+//	objects/<bucket>/<sha256(key)>/  version index and noncurrent versions of a key
+//	dirs/<bucket>/<sha256(dir)>      directories created by keys ending with a slash, encoded layout only
+//	<queue>/<entry>.json             queued background work
+//	tmp/                             object data staged until it is complete
+//
+// The data of the latest version stays at its plain path in root in the
+// plain layout and is the file latest in the object directory in the
+// encoded layout.
+type FileBackend struct {
+	root     string
+	metadata string
+	encoded  bool
+	treeMu   sync.Mutex
+}
+
+// NewFileBackend creates root and its metadata directory if missing. An
+// empty layout opens the layout recorded in the mount. New mounts use the
+// encoded layout, mounts with buckets but without a recorded layout were
+// written in the plain layout.
+func NewFileBackend(root string, metadata string, layout string) (*FileBackend, error) {
+	for _, dir := range []string{root, filepath.Join(root, metadata)} {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err := os.Mkdir(dir, os.ModePerm); err != nil {
+				return nil, err
+			}
+			log.Printf("Directory created at %s", dir)
+		}
+	}
+	b := &FileBackend{root: root, metadata: metadata}
+
+	recorded, err := os.ReadFile(b.metadataPath("layout"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	existing := strings.TrimSpace(string(recorded))
+	if len(existing) == 0 {
+		buckets, err := b.ListBuckets()
+		if err != nil {
+			return nil, err
+		}
+		if len(buckets) > 0 {
+			existing = LayoutPlain
+		}
+	}
+	if len(layout) == 0 {
+		layout = existing
+	}
+	if len(layout) == 0 {
+		layout = LayoutEncoded
+	}
+	if layout != LayoutPlain && layout != LayoutEncoded {
+		return nil, fmt.Errorf("unknown layout %s", layout)
+	}
+	if len(existing) > 0 && existing != layout {
+		return nil, fmt.Errorf("%s uses the %s layout", root, existing)
+	}
+	if len(recorded) == 0 {
+		if err := writeFile(b.metadataPath("layout"), []byte(layout+"\n")); err != nil {
+			return nil, err
+		}
+	}
+	b.encoded = layout == LayoutEncoded
+
+	// staged data left by a crash was never committed
+	if err := os.RemoveAll(b.metadataPath("tmp")); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *FileBackend) bucketPath(bucket string) (string, error) {
+	if len(bucket) == 0 || bucket == b.metadata || bucket == "." || bucket == ".." || strings.ContainsAny(bucket, "/\\") {
+		return "", &fs.PathError{Op: "stat", Path: bucket, Err: fs.ErrNotExist}
+	}
+	return filepath.Join(b.root, bucket), nil
+}
+
+// objectPath returns the plain path of key, keys must not leave the bucket.
+func (b *FileBackend) objectPath(bucket string, key string) (string, error) {
+	root, err := b.bucketPath(bucket)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(root, key)
+	if path != root && !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return "", &fs.PathError{Op: "open", Path: key, Err: fs.ErrInvalid}
+	}
+	return path, nil
+}
+
+// checkPlainPath fails with ErrKeyConflict if path is a directory or one of
+// its parents in the bucket is a file.
+func (b *FileBackend) checkPlainPath(bucket string, path string) error {
+	root, err := b.bucketPath(bucket)
+	if err != nil {
+		return err
+	}
+	if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+		return &fs.PathError{Op: "create", Path: path, Err: ErrKeyConflict}
+	}
+	for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if stat, err := os.Stat(dir); err == nil && !stat.IsDir() {
+			return &fs.PathError{Op: "create", Path: path, Err: ErrKeyConflict}
+		}
+	}
+	return nil
+}
+
+func (b *FileBackend) metadataPath(elem ...string) string {
+	return filepath.Join(append([]string{b.root, b.metadata}, elem...)...)
+}
+
+func (b *FileBackend) indexPath(bucket string, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return b.metadataPath("objects", bucket, hex.EncodeToString(sum[:]))
+}
+
+// dataPath returns the path of the latest data or of an archived version.
+func (b *FileBackend) dataPath(bucket string, key string, versionID string) (string, error) {
+	if b.encoded {
+		if _, err := b.bucketPath(bucket); err != nil {
+			return "", err
+		}
+		if len(versionID) == 0 {
+			versionID = "latest"
+		}
+		return filepath.Join(b.indexPath(bucket, key), versionID), nil
+	}
+
+	path, err := b.objectPath(bucket, key)
+	if err != nil || len(versionID) == 0 {
+		return path, err
+	}
+	return filepath.Join(b.indexPath(bucket, key), versionID), nil
+}
+
+func (b *FileBackend) ListBuckets() ([]BucketInfo, error) {
+	files, err := os.ReadDir(b.root)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := []BucketInfo{}
+	for _, file := range files {
+		if !file.IsDir() || file.Name() == b.metadata {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		buckets = append(buckets, BucketInfo{Name: info.Name(), CreationDate: info.ModTime()})
+	}
+	return buckets, nil
+}
+
+func (b *FileBackend) CreateBucket(bucket string) error {
+	if bucket == b.metadata {
+		return &fs.PathError{Op: "mkdir", Path: bucket, Err: fs.ErrExist}
+	}
+	path, err := b.bucketPath(bucket)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(path, os.ModePerm)
+}
+
+func (b *FileBackend) HeadBucket(bucket string) (BucketInfo, error) {
+	path, err := b.bucketPath(bucket)
+	if err != nil {
+		return BucketInfo{}, err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return BucketInfo{}, err
+	}
+	if !stat.IsDir() {
+		return BucketInfo{}, &fs.PathError{Op: "stat", Path: bucket, Err: fs.ErrNotExist}
+	}
+	return BucketInfo{Name: bucket, CreationDate: stat.ModTime()}, nil
+}
+
+func (b *FileBackend) DeleteBucket(bucket string) error {
+	path, err := b.bucketPath(bucket)
+	if err != nil {
+		return err
+	}
+
+	contents, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	if len(contents) > 0 {
+		return ErrBucketNotEmpty
+	}
+
+	// noncurrent versions and delete markers
+	versions, err := os.ReadDir(b.metadataPath("objects", bucket))
+	if err == nil && len(versions) > 0 {
+		return ErrBucketNotEmpty
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	for _, dir := range []string{b.metadataPath("buckets", bucket), b.metadataPath("objects", bucket), b.metadataPath("dirs", bucket), b.metadataPath("tree", bucket)} {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("can not delete metadata of %s: %v", bucket, err)
+		}
+	}
+	return nil
+}
+
+func (b *FileBackend) StatObject(bucket string, key string) (ObjectInfo, error) {
+	if b.encoded {
+		return b.statEncoded(bucket, key)
+	}
+	path, err := b.objectPath(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Name: stat.Name(), Size: stat.Size(), ModTime: stat.ModTime(), IsDir: stat.IsDir()}, nil
+}
+
+func (b *FileBackend) ListDir(bucket string, dir string) ([]ObjectInfo, error) {
+	if b.encoded {
+		return b.listDirEncoded(bucket, dir)
+	}
+	path, err := b.objectPath(bucket, dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []ObjectInfo{}
+	for _, file := range files {
+		stat, err := file.Info()
+		if err != nil {
+			continue
+		}
+		objects = append(objects, ObjectInfo{Name: stat.Name(), Size: stat.Size(), ModTime: stat.ModTime(), IsDir: stat.IsDir()})
+	}
+	return objects, nil
+}
+
+func (b *FileBackend) ListKeys(bucket string, prefix string) ([]string, error) {
+	root, err := b.bucketPath(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := b.objectDirs(bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if !b.encoded {
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			key := filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator)))
+			if strings.HasPrefix(key, prefix) {
+				found[key] = b.indexPath(bucket, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]string, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// objectDirs returns the object directories of the keys with prefix.
+func (b *FileBackend) objectDirs(bucket string, prefix string) (map[string]string, error) {
+	found := make(map[string]string)
+	dirs, err := os.ReadDir(b.metadataPath("objects", bucket))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(b.metadataPath("objects", bucket), dir.Name())
+		key, ok, err := b.objectDirKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if ok && strings.HasPrefix(key, prefix) {
+			found[key] = path
+		}
+	}
+	return found, nil
+}
+
+// objectDirKey returns the key of an object directory with a version index
+// or, in the encoded layout, with latest data.
+func (b *FileBackend) objectDirKey(path string) (string, bool, error) {
+	if data, err := os.ReadFile(filepath.Join(path, "index.json")); err == nil {
+		var idx ObjectIndex
+		if err := json.Unmarshal(data, &idx); err != nil {
+			return "", false, err
+		}
+		return idx.Key, true, nil
+	}
+	if !b.encoded {
+		return "", false, nil
+	}
+	if _, err := os.Stat(filepath.Join(path, "latest")); err != nil {
+		return "", false, nil
+	}
+	key, err := os.ReadFile(filepath.Join(path, "key"))
+	if err != nil {
+		return "", false, nil
+	}
+	return string(key), true, nil
+}
+
+func (b *FileBackend) OpenObject(bucket string, key string, versionID string) (io.ReadSeekCloser, error) {
+	path, err := b.dataPath(bucket, key, versionID)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if stat, err := file.Stat(); err != nil || stat.IsDir() {
+		file.Close()
+		return nil, &fs.PathError{Op: "open", Path: key, Err: fs.ErrNotExist}
+	}
+	return file, nil
+}
+
+func (b *FileBackend) CreateObject(bucket string, key string) (ObjectWriter, error) {
+	path, err := b.dataPath(bucket, key, "")
+	if err != nil {
+		return nil, err
+	}
+	if !b.encoded {
+		if err := b.checkPlainPath(bucket, path); err != nil {
+			return nil, err
+		}
+	}
+
+	// staged in the metadata directory, which is on the same file system
+	// as the bucket so the data can be renamed into place
+	dir := b.metadataPath("tmp")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(dir, "object-*")
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	w := &fileWriter{file: file, path: path}
+	if b.encoded {
+		// the key can not be recovered from the hashed path
+		w.key = key
+		w.keyPath = filepath.Join(filepath.Dir(path), "key")
+		w.link = func() error { return b.linkKey(bucket, key) }
+	}
+	return w, nil
+}
+
+// fileWriter writes into a temporary file which replaces the plain file of
+// the key on Commit, readers never see partially written data.
+type fileWriter struct {
+	file    *os.File
+	path    string
+	key     string
+	keyPath string
+	link    func() error
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+func (w *fileWriter) Commit() error {
+	err := w.file.Sync()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(w.path), os.ModePerm)
+	}
+	if err == nil && len(w.keyPath) > 0 {
+		err = writeFile(w.keyPath, []byte(w.key))
+	}
+	if err == nil {
+		err = os.Rename(w.file.Name(), w.path)
+	}
+	if err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+	syncDir(filepath.Dir(w.path))
+	if w.link != nil {
+		return w.link()
+	}
+	return nil
+}
+
+func (w *fileWriter) Abort() error {
+	w.file.Close()
+	if err := os.Remove(w.file.Name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (b *FileBackend) ArchiveObject(bucket string, key string, versionID string) error {
+	plain, err := b.dataPath(bucket, key, "")
+	if err != nil {
+		return err
+	}
+	archived, err := b.dataPath(bucket, key, versionID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(archived), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(plain, archived); err != nil {
+		return err
+	}
+	if b.encoded {
+		return b.unlinkKey(bucket, key)
+	}
+	return nil
+}
+
+func (b *FileBackend) RestoreObject(bucket string, key string, versionID string) error {
+	plain, err := b.dataPath(bucket, key, "")
+	if err != nil {
+		return err
+	}
+	archived, err := b.dataPath(bucket, key, versionID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(plain), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(archived, plain); err != nil {
+		return err
+	}
+	if b.encoded {
+		return b.linkKey(bucket, key)
+	}
+	return nil
+}
+
+func (b *FileBackend) RemoveObject(bucket string, key string, versionID string) error {
+	path, err := b.dataPath(bucket, key, versionID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if b.encoded && len(versionID) == 0 {
+		return b.unlinkKey(bucket, key)
+	}
+	return nil
+}
+
+func (b *FileBackend) MakeDir(bucket string, key string) error {
+	if b.encoded {
+		return b.makeDirEncoded(bucket, key)
+	}
+	path, err := b.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return &fs.PathError{Op: "mkdir", Path: key, Err: fs.ErrExist}
+	}
+	return os.MkdirAll(path, os.ModePerm)
+}
+
+func (b *FileBackend) RemoveDir(bucket string, key string) error {
+	if b.encoded {
+		return b.removeDirEncoded(bucket, key)
+	}
+	path, err := b.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
+
+func (b *FileBackend) ReadObjectIndex(bucket string, key string) (*ObjectIndex, error) {
+	data, err := os.ReadFile(filepath.Join(b.indexPath(bucket, key), "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	idx := &ObjectIndex{Key: key}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("corrupt metadata of %s/%s: %v", bucket, key, err)
+	}
+	return idx, nil
+}
+
+func (b *FileBackend) WriteObjectIndex(bucket string, idx *ObjectIndex) error {
+	dir := b.indexPath(bucket, idx.Key)
+	if len(idx.Versions) == 0 {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		if b.encoded {
+			return b.unlinkKey(bucket, idx.Key)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, "index.json"), data)
+}
+
+func (b *FileBackend) CreateMultipartUpload(uploadID string, key string, meta *ObjectMeta) error {
+	dir := b.metadataPath(uploadID)
+	path := filepath.Join(dir, key)
+	if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return &fs.PathError{Op: "open", Path: key, Err: fs.ErrInvalid}
+	}
+
+	// metadata of the object created when the upload completes
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(dir+".json", data); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (b *FileBackend) ReadMetadata(name string) ([]byte, error) {
+	return os.ReadFile(b.metadataPath(filepath.FromSlash(name)))
+}
+
+func (b *FileBackend) WriteMetadata(name string, data []byte) error {
+	return writeFile(b.metadataPath(filepath.FromSlash(name)), data)
+}
+
+func (b *FileBackend) DeleteMetadata(name string) error {
+	if err := os.Remove(b.metadataPath(filepath.FromSlash(name))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (b *FileBackend) ListMetadata(dir string) ([]string, error) {
+	entries, err := os.ReadDir(b.metadataPath(filepath.FromSlash(dir)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && !strings.HasSuffix(e.Name(), ".tmp") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// writeFile replaces the file at path so readers never see a partial file.
+func writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = tmp.Chmod(0644)
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir persists a rename into dir. Not every platform can sync
+// directories, so errors are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
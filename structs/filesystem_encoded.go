@@ -0,0 +1,266 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// In the encoded layout directories only exist as prefixes of keys or as
+// markers created by keys ending with a slash. Every directory keeps its
+// entries in tree/<bucket>/<sha256(dir)>, one file per object or
+// subdirectory named by the hash of the entry, so looking up a directory
+// never scans the keys of the bucket.
+
+func hashName(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+func (b *FileBackend) markerPath(bucket string, dir string) string {
+	return b.metadataPath("dirs", bucket, hashName(dir))
+}
+
+// treePath returns the entries directory of dir, or the file of entry.
+// Subdirectory entries end with a slash.
+func (b *FileBackend) treePath(bucket string, dir string, entry ...string) string {
+	path := b.metadataPath("tree", bucket, hashName(dir))
+	if len(entry) > 0 {
+		path = filepath.Join(path, hashName(entry[0]))
+	}
+	return path
+}
+
+// splitKey returns the directory of key without trailing slash and the name.
+func splitKey(key string) (string, string) {
+	i := strings.LastIndex(key, "/")
+	if i < 0 {
+		return "", key
+	}
+	return key[:i], key[i+1:]
+}
+
+func joinKey(dir string, name string) string {
+	if len(dir) == 0 {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// linkEntry adds entry to dir and dir to its parents.
+func (b *FileBackend) linkEntry(bucket string, dir string, entry string) error {
+	b.treeMu.Lock()
+	defer b.treeMu.Unlock()
+
+	for {
+		path := b.treePath(bucket, dir, entry)
+		if _, err := os.Stat(path); err == nil {
+			// the parents of a linked entry are linked
+			return nil
+		}
+		if err := writeFile(path, []byte(entry)); err != nil {
+			return err
+		}
+		if len(dir) == 0 {
+			return nil
+		}
+		parent, name := splitKey(dir)
+		dir, entry = parent, name+"/"
+	}
+}
+
+// unlinkEntry removes entry from dir and removes directories left without
+// entries or marker from their parents.
+func (b *FileBackend) unlinkEntry(bucket string, dir string, entry string) error {
+	b.treeMu.Lock()
+	defer b.treeMu.Unlock()
+
+	for {
+		if err := os.Remove(b.treePath(bucket, dir, entry)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if len(dir) == 0 || b.hasEntries(bucket, dir) {
+			return nil
+		}
+		if _, err := os.Stat(b.markerPath(bucket, dir)); err == nil {
+			return nil
+		}
+		os.Remove(b.treePath(bucket, dir))
+		parent, name := splitKey(dir)
+		dir, entry = parent, name+"/"
+	}
+}
+
+func (b *FileBackend) linkKey(bucket string, key string) error {
+	dir, name := splitKey(key)
+	return b.linkEntry(bucket, dir, name)
+}
+
+func (b *FileBackend) unlinkKey(bucket string, key string) error {
+	dir, name := splitKey(key)
+	return b.unlinkEntry(bucket, dir, name)
+}
+
+func (b *FileBackend) hasEntries(bucket string, dir string) bool {
+	f, err := os.Open(b.treePath(bucket, dir))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	for {
+		names, err := f.Readdirnames(16)
+		for _, name := range names {
+			if !strings.HasSuffix(name, ".tmp") {
+				return true
+			}
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// dirEntries returns the names of the objects and subdirectories of dir.
+func (b *FileBackend) dirEntries(bucket string, dir string) ([]string, []string, error) {
+	entries, err := os.ReadDir(b.treePath(bucket, dir))
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	objects, dirs := []string{}, []string{}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		entry, err := os.ReadFile(filepath.Join(b.treePath(bucket, dir), e.Name()))
+		if err != nil {
+			continue
+		}
+		if name, ok := strings.CutSuffix(string(entry), "/"); ok {
+			dirs = append(dirs, name)
+		} else {
+			objects = append(objects, string(entry))
+		}
+	}
+	return objects, dirs, nil
+}
+
+// encodedDir reports whether dir exists and returns the modification time
+// of its marker.
+func (b *FileBackend) encodedDir(bucket string, dir string) (time.Time, bool) {
+	if stat, err := os.Stat(b.markerPath(bucket, dir)); err == nil {
+		return stat.ModTime(), true
+	}
+	return time.Time{}, len(dir) == 0 || b.hasEntries(bucket, dir)
+}
+
+func (b *FileBackend) statEncoded(bucket string, key string) (ObjectInfo, error) {
+	info, err := b.HeadBucket(bucket)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if len(key) == 0 {
+		return ObjectInfo{Name: bucket, ModTime: info.CreationDate, IsDir: true}, nil
+	}
+
+	name := strings.TrimSuffix(key[strings.LastIndex(strings.TrimSuffix(key, "/"), "/")+1:], "/")
+	if !strings.HasSuffix(key, "/") {
+		path, err := b.dataPath(bucket, key, "")
+		if err != nil {
+			return ObjectInfo{}, err
+		}
+		if stat, err := os.Stat(path); err == nil {
+			return ObjectInfo{Name: name, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+		}
+	}
+
+	modTime, exists := b.encodedDir(bucket, strings.TrimSuffix(key, "/"))
+	if !exists {
+		return ObjectInfo{}, notExist("stat", key)
+	}
+	return ObjectInfo{Name: name, ModTime: modTime, IsDir: true}, nil
+}
+
+func (b *FileBackend) listDirEncoded(bucket string, dir string) ([]ObjectInfo, error) {
+	if _, err := b.HeadBucket(bucket); err != nil {
+		return nil, err
+	}
+	dir = strings.TrimSuffix(dir, "/")
+	if _, exists := b.encodedDir(bucket, dir); !exists {
+		return nil, notExist("open", dir)
+	}
+
+	names, subdirs, err := b.dirEntries(bucket, dir)
+	if err != nil {
+		return nil, err
+	}
+	objects := []ObjectInfo{}
+	for _, name := range names {
+		key := joinKey(dir, name)
+		path, err := b.dataPath(bucket, key, "")
+		if err != nil {
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		objects = append(objects, ObjectInfo{Name: key, Size: stat.Size(), ModTime: stat.ModTime()})
+	}
+	dirs := make(map[string]time.Time)
+	for _, name := range subdirs {
+		d := joinKey(dir, name)
+		dirs[d], _ = b.encodedDir(bucket, d)
+	}
+	return listKeyDir(objects, dirs, dir), nil
+}
+
+func (b *FileBackend) makeDirEncoded(bucket string, key string) error {
+	if _, err := b.HeadBucket(bucket); err != nil {
+		return err
+	}
+	dir := strings.TrimSuffix(key, "/")
+	if _, exists := b.encodedDir(bucket, dir); exists {
+		return &fs.PathError{Op: "mkdir", Path: key, Err: fs.ErrExist}
+	}
+	if err := writeFile(b.markerPath(bucket, dir), []byte(dir)); err != nil {
+		return err
+	}
+	parent, name := splitKey(dir)
+	return b.linkEntry(bucket, parent, name+"/")
+}
+
+func (b *FileBackend) removeDirEncoded(bucket string, key string) error {
+	dir := strings.TrimSuffix(key, "/")
+	names, subdirs, err := b.dirEntries(bucket, dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range subdirs {
+		if err := b.removeDirEncoded(bucket, joinKey(dir, name)); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		if err := b.RemoveObject(bucket, joinKey(dir, name), ""); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(b.markerPath(bucket, dir)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(dir) == 0 {
+		return nil
+	}
+	parent, name := splitKey(dir)
+	return b.unlinkEntry(bucket, parent, name+"/")
+}
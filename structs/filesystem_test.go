@@ -0,0 +1,167 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileBackendObjectPath(t *testing.T) {
+	b, err := NewFileBackend(t.TempDir(), ".s3-go", LayoutPlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		bucket string
+		key    string
+		err    error
+	}{
+		{"photos", "a.jpg", nil},
+		{"photos", "2023/a.jpg", nil},
+		{"photos", "2023/../a.jpg", nil},
+		{"photos", "../a.jpg", fs.ErrInvalid},
+		{"photos", "2023/../../a.jpg", fs.ErrInvalid},
+		{".s3-go", "buckets", fs.ErrNotExist},
+		{"..", "a.jpg", fs.ErrNotExist},
+		{"", "a.jpg", fs.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.bucket+"/"+tt.key, func(t *testing.T) {
+			_, err := b.objectPath(tt.bucket, tt.key)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewFileBackendLayout(t *testing.T) {
+	legacy := t.TempDir()
+	if _, err := NewFileBackend(legacy, ".s3-go", LayoutPlain); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		root   string
+		layout string
+		want   bool
+		err    bool
+	}{
+		{"new mount", t.TempDir(), "", true, false},
+		{"recorded", legacy, "", false, false},
+		{"mismatch", legacy, LayoutEncoded, false, true},
+		{"unknown", t.TempDir(), "flat", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewFileBackend(tt.root, ".s3-go", tt.layout)
+			if (err != nil) != tt.err || (err == nil && b.encoded != tt.want) {
+				t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v %v", b != nil && b.encoded, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestFileBackendEncodedKeys(t *testing.T) {
+	b, err := NewFileBackend(t.TempDir(), ".s3-go", LayoutEncoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.CreateBucket("photos"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{"a", "a/b", "a//c", "../d", "e/../f", "100% + ü", strings.Repeat("k/", 512)}
+	for _, key := range keys {
+		writeObject(t, b, "photos", key, key)
+		if err := b.WriteObjectIndex("photos", &ObjectIndex{Key: key, Versions: []ObjectMeta{{VersionID: "null"}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range keys {
+		if got := readObject(b, "photos", key, ""); got != key {
+			t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", got, key)
+		}
+	}
+
+	infos, err := b.ListDir("photos", "a/")
+	got := []string{}
+	for _, info := range infos {
+		if info.IsDir {
+			info.Name += "/"
+		}
+		got = append(got, info.Name)
+	}
+	if want := []string{"/", "b"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", got, err, want)
+	}
+	if stat, err := b.StatObject("photos", "a"); err != nil || stat.IsDir {
+		t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", stat, err, "object")
+	}
+	if stat, err := b.StatObject("photos", "a/"); err != nil || !stat.IsDir {
+		t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", stat, err, "directory")
+	}
+}
+
+func TestFileBackendEncodedDirs(t *testing.T) {
+	b, err := NewFileBackend(t.TempDir(), ".s3-go", LayoutEncoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.CreateBucket("photos"); err != nil {
+		t.Fatal(err)
+	}
+	writeObject(t, b, "photos", "a/b/c", "c")
+	if err := b.MakeDir("photos", "d/"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remove func() error
+		key    string
+		exists bool
+	}{
+		{nil, "a/b/", true},
+		{nil, "d/", true},
+		{func() error { return b.RemoveObject("photos", "a/b/c", "") }, "a/", false},
+		{func() error { return b.RemoveDir("photos", "d/") }, "d/", false},
+	}
+	for _, test := range tests {
+		if test.remove != nil {
+			if err := test.remove(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := b.StatObject("photos", test.key)
+		if got := err == nil; got != test.exists {
+			t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", got, err, test.exists)
+		}
+	}
+	if infos, err := b.ListDir("photos", ""); err != nil || len(infos) > 0 {
+		t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", infos, err, "empty")
+	}
+}
+
+func TestFileBackendPlainConflict(t *testing.T) {
+	b, err := NewFileBackend(t.TempDir(), ".s3-go", LayoutPlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.CreateBucket("photos"); err != nil {
+		t.Fatal(err)
+	}
+	writeObject(t, b, "photos", "a/b", "b")
+
+	for _, key := range []string{"a", "a/b/c"} {
+		if _, err := b.CreateObject("photos", key); !errors.Is(err, ErrKeyConflict) {
+			t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, ErrKeyConflict)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type IAMPolicy struct {
+	Version   string
+	Statement []IAMStatement
+}
+
+type IAMStatement struct {
+	Sid      string `json:",omitempty"`
+	Effect   string
+	Action   StringList
+	Resource StringList
+}
+
+// StringList accepts a single string or a list of strings.
+type StringList []string
+
+func (s *StringList) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*s = []string{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+func ParseIAMPolicy(policy string) (*IAMPolicy, error) {
+	var p IAMPolicy
+	if err := json.Unmarshal([]byte(policy), &p); err != nil {
+		return nil, fmt.Errorf("malformed policy document: %v", err)
+	}
+	if len(p.Statement) == 0 {
+		return nil, fmt.Errorf("policy has no statements")
+	}
+	for _, s := range p.Statement {
+		if s.Effect != "Allow" && s.Effect != "Deny" {
+			return nil, fmt.Errorf("invalid effect %q", s.Effect)
+		}
+	}
+	return &p, nil
+}
+
+// IsAllowed evaluates the policy. An explicit deny wins over any allow and
+// actions without a matching allow are denied.
+func (p *IAMPolicy) IsAllowed(action string, resource string) bool {
+	allowed := false
+	for _, s := range p.Statement {
+		if !matchAny(s.Action, action, true) || !matchAny(s.Resource, resource, false) {
+			continue
+		}
+		if s.Effect == "Deny" {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+func matchAny(patterns []string, value string, fold bool) bool {
+	for _, p := range patterns {
+		if fold && WildcardMatch(strings.ToLower(p), strings.ToLower(value)) {
+			return true
+		}
+		if !fold && WildcardMatch(p, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// WildcardMatch matches value against a pattern with * and ? wildcards.
+func WildcardMatch(pattern string, value string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(value); i >= 0; i-- {
+				if WildcardMatch(pattern[1:], value[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(value) == 0 {
+				return false
+			}
+		default:
+			if len(value) == 0 || pattern[0] != value[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		value = value[1:]
+	}
+	return len(value) == 0
+}
+
+// bucketActions maps http method and subresource of bucket requests to
+// the IAM action. The empty subresource is the default.
+var bucketActions = map[string]map[string]string{
+	http.MethodGet: {
+		"":             "s3:ListBucket",
+		"cors":         "s3:GetBucketCORS",
+		"encryption":   "s3:GetEncryptionConfiguration",
+		"events":       "s3:ListenBucketNotification",
+		"lifecycle":    "s3:GetLifecycleConfiguration",
+		"logging":      "s3:GetBucketLogging",
+		"notification": "s3:GetBucketNotification",
+		"object-lock":  "s3:GetBucketObjectLockConfiguration",
+		"replication":  "s3:GetReplicationConfiguration",
+		"tagging":      "s3:GetBucketTagging",
+		"versioning":   "s3:GetBucketVersioning",
+		"versions":     "s3:ListBucketVersions",
+		"website":      "s3:GetBucketWebsite",
+		"uploads":      "s3:ListBucketMultipartUploads",
+	},
+	http.MethodHead: {
+		"": "s3:ListBucket",
+	},
+	http.MethodPut: {
+		"":             "s3:CreateBucket",
+		"cors":         "s3:PutBucketCORS",
+		"encryption":   "s3:PutEncryptionConfiguration",
+		"lifecycle":    "s3:PutLifecycleConfiguration",
+		"logging":      "s3:PutBucketLogging",
+		"notification": "s3:PutBucketNotification",
+		"object-lock":  "s3:PutBucketObjectLockConfiguration",
+		"replication":  "s3:PutReplicationConfiguration",
+		"tagging":      "s3:PutBucketTagging",
+		"versioning":   "s3:PutBucketVersioning",
+		"website":      "s3:PutBucketWebsite",
+	},
+	http.MethodPost: {
+		"":       "s3:PutObject",
+		"delete": "s3:DeleteObject",
+	},
+	http.MethodDelete: {
+		"":            "s3:DeleteBucket",
+		"cors":        "s3:PutBucketCORS",
+		"encryption":  "s3:PutEncryptionConfiguration",
+		"lifecycle":   "s3:PutLifecycleConfiguration",
+		"replication": "s3:PutReplicationConfiguration",
+		"tagging":     "s3:PutBucketTagging",
+		"website":     "s3:DeleteBucketWebsite",
+	},
+}
+
+// objectActions maps http method and subresource of object requests to
+// the IAM action. The empty subresource is the default.
+var objectActions = map[string]map[string]string{
+	http.MethodGet: {
+		"":           "s3:GetObject",
+		"legal-hold": "s3:GetObjectLegalHold",
+		"retention":  "s3:GetObjectRetention",
+		"tagging":    "s3:GetObjectTagging",
+		"uploadId":   "s3:ListMultipartUploadParts",
+		"versionId":  "s3:GetObjectVersion",
+	},
+	http.MethodHead: {
+		"":          "s3:GetObject",
+		"versionId": "s3:GetObjectVersion",
+	},
+	http.MethodPut: {
+		"":           "s3:PutObject",
+		"legal-hold": "s3:PutObjectLegalHold",
+		"retention":  "s3:PutObjectRetention",
+		"tagging":    "s3:PutObjectTagging",
+	},
+	http.MethodPost: {
+		"":         "s3:PutObject",
+		"uploads":  "s3:PutObject",
+		"uploadId": "s3:PutObject",
+	},
+	http.MethodDelete: {
+		"":          "s3:DeleteObject",
+		"tagging":   "s3:DeleteObjectTagging",
+		"uploadId":  "s3:AbortMultipartUpload",
+		"versionId": "s3:DeleteObjectVersion",
+	},
+}
+
+// RequestAction returns the IAM action and resource ARN of a S3 request.
+func RequestAction(r *http.Request) (string, string) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if len(path) == 0 {
+		return "s3:ListAllMyBuckets", "arn:aws:s3:::*"
+	}
+
+	bucket, key, _ := strings.Cut(path, "/")
+	actions := bucketActions
+	resource := "arn:aws:s3:::" + bucket
+	if len(key) > 0 {
+		actions = objectActions
+		resource += "/" + key
+	}
+
+	// versionId only qualifies the action of the plain object request
+	query := r.URL.Query()
+	action := actions[r.Method][""]
+	for subresource, a := range actions[r.Method] {
+		if len(subresource) == 0 || !query.Has(subresource) {
+			continue
+		}
+		if subresource != "versionId" {
+			return a, resource
+		}
+		action = a
+	}
+	return action, resource
+}
@@ -0,0 +1,41 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"testing"
+)
+
+func TestIAMPolicy(t *testing.T) {
+	p, err := ParseIAMPolicy(`{
+		"Version": "2012-10-17",
+		"Statement": [
+			{"Effect": "Allow", "Action": ["s3:GetObject", "s3:PutObject"], "Resource": "arn:aws:s3:::builds/*"},
+			{"Effect": "Allow", "Action": "s3:List*", "Resource": "arn:aws:s3:::builds"},
+			{"Effect": "Deny", "Action": "s3:PutObject", "Resource": "arn:aws:s3:::builds/release/*"}
+		]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		action   string
+		resource string
+		want     bool
+	}{
+		{"s3:GetObject", "arn:aws:s3:::builds/a/b.tar", true},
+		{"s3:putobject", "arn:aws:s3:::builds/a/b.tar", true},
+		{"s3:PutObject", "arn:aws:s3:::builds/release/b.tar", false},
+		{"s3:ListBucket", "arn:aws:s3:::builds", true},
+		{"s3:ListBucket", "arn:aws:s3:::other", false},
+		{"s3:DeleteObject", "arn:aws:s3:::builds/a/b.tar", false},
+	}
+
+	for _, tt := range tests {
+		if got := p.IsAllowed(tt.action, tt.resource); got != tt.want {
+			t.Errorf("IsAllowed(%s, %s) was incorrect\ngot: %v\n\nwant: %v", tt.action, tt.resource, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	KMSKeyArnPrefix = "arn:aws:kms:us-east-1:000000000000:"
+	KMSDefaultAlias = "alias/aws/s3"
+)
+
+// Keyring emulates KMS with symmetric keys from a local file:
+//
+//	{"Keys": [{"KeyId": "1234abcd-...", "Aliases": ["alias/aws/s3"], "Key": "<base64 256 bit key>"}]}
+type Keyring struct {
+	Keys []KMSKey
+}
+
+type KMSKey struct {
+	KeyId   string
+	Aliases []string
+	Key     []byte
+}
+
+// Arn returns the ARN of the key.
+func (k *KMSKey) Arn() string {
+	return KMSKeyArnPrefix + "key/" + k.KeyId
+}
+
+func LoadKeyring(path string) (*Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Keys []struct {
+			KeyId   string
+			Aliases []string
+			Key     string
+		}
+	}
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("can not parse %s: %v", path, err)
+	}
+
+	k := &Keyring{}
+	for _, e := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(e.Key)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("key %s must be a base64 encoded 256 bit key", e.KeyId)
+		}
+		if len(e.KeyId) == 0 {
+			return nil, fmt.Errorf("key without KeyId")
+		}
+		for _, alias := range e.Aliases {
+			if !strings.HasPrefix(alias, "alias/") {
+				return nil, fmt.Errorf("alias %s of key %s must start with alias/", alias, e.KeyId)
+			}
+		}
+		k.Keys = append(k.Keys, KMSKey{KeyId: e.KeyId, Aliases: e.Aliases, Key: key})
+	}
+	if len(k.Keys) == 0 {
+		return nil, fmt.Errorf("keyring %s has no keys", path)
+	}
+	return k, nil
+}
+
+// Lookup resolves a key ID, key ARN, alias name or alias ARN. The empty ID
+// selects the key with the alias aws/s3.
+func (k *Keyring) Lookup(id string) (*KMSKey, error) {
+	if len(id) == 0 {
+		id = KMSDefaultAlias
+	}
+	id = strings.TrimPrefix(id, KMSKeyArnPrefix)
+	id = strings.TrimPrefix(id, "key/")
+
+	for i, key := range k.Keys {
+		if key.KeyId == id {
+			return &k.Keys[i], nil
+		}
+		for _, alias := range key.Aliases {
+			if alias == id {
+				return &k.Keys[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("key %s does not exist", id)
+}
+
+// ParseEncryptionContext decodes the base64 encoded JSON of the
+// x-amz-server-side-encryption-context header.
+func ParseEncryptionContext(header string) (map[string]string, error) {
+	context := make(map[string]string)
+	if len(header) == 0 {
+		return context, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return nil, fmt.Errorf("encryption context is not base64 encoded")
+	}
+	if err := json.Unmarshal(b, &context); err != nil {
+		return nil, fmt.Errorf("encryption context must be a JSON object of strings")
+	}
+	return context, nil
+}
+
+// EncodeEncryptionContext returns the canonical base64 encoded JSON of an
+// encryption context, keys are sorted.
+func EncodeEncryptionContext(context map[string]string) string {
+	b, _ := json.Marshal(context)
+	return base64.StdEncoding.EncodeToString(b)
+}
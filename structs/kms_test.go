@@ -0,0 +1,79 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	os.WriteFile(path, []byte(`{"Keys": [
+		{"KeyId": "1234abcd-12ab-34cd-56ef-1234567890ab", "Aliases": ["alias/aws/s3"], "Key": "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+		{"KeyId": "0987dcba-09fe-87dc-65ba-ab0987654321", "Aliases": ["alias/app"], "Key": "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="}
+	]}`), 0600)
+
+	k, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"", "1234abcd-12ab-34cd-56ef-1234567890ab"},
+		{"0987dcba-09fe-87dc-65ba-ab0987654321", "0987dcba-09fe-87dc-65ba-ab0987654321"},
+		{"arn:aws:kms:us-east-1:000000000000:key/0987dcba-09fe-87dc-65ba-ab0987654321", "0987dcba-09fe-87dc-65ba-ab0987654321"},
+		{"alias/app", "0987dcba-09fe-87dc-65ba-ab0987654321"},
+		{"arn:aws:kms:us-east-1:000000000000:alias/app", "0987dcba-09fe-87dc-65ba-ab0987654321"},
+		{"alias/missing", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			key, err := k.Lookup(tt.id)
+			if len(tt.want) == 0 {
+				if err == nil {
+					t.Errorf("result was incorrect\ngot: %v\n\nwant: error", key.KeyId)
+				}
+				return
+			}
+			if err != nil || key.KeyId != tt.want {
+				t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", key, err, tt.want)
+			}
+		})
+	}
+
+	t.Run("arn", func(t *testing.T) {
+		key, _ := k.Lookup("alias/app")
+		expected := "arn:aws:kms:us-east-1:000000000000:key/0987dcba-09fe-87dc-65ba-ab0987654321"
+		if key.Arn() != expected {
+			t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", key.Arn(), expected)
+		}
+	})
+}
+
+func TestEncryptionContext(t *testing.T) {
+	context, err := ParseEncryptionContext("eyJwcm9qZWN0IjoiczMtZ28iLCJhIjoiYiJ9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"project": "s3-go", "a": "b"}
+	if !reflect.DeepEqual(expected, context) {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", context, expected)
+	}
+
+	// canonical encoding sorts the keys
+	encoded := EncodeEncryptionContext(context)
+	if encoded != "eyJhIjoiYiIsInByb2plY3QiOiJzMy1nbyJ9" {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", encoded, "eyJhIjoiYiIsInByb2plY3QiOiJzMy1nbyJ9")
+	}
+
+	if _, err := ParseEncryptionContext("eyJhIjoxfQ=="); err == nil {
+		t.Error("context with number accepted")
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Validate checks a lifecycle configuration as S3 does on PUT.
+func (c *LifecycleConfiguration) Validate() error {
+	if len(c.Rules) == 0 {
+		return fmt.Errorf("lifecycle configuration has no rules")
+	}
+	if len(c.Rules) > 1000 {
+		return fmt.Errorf("lifecycle configuration has more than 1000 rules")
+	}
+
+	ids := make(map[string]bool)
+	for _, r := range c.Rules {
+		if len(r.ID) > 255 {
+			return fmt.Errorf("rule id is longer than 255 characters")
+		}
+		if len(r.ID) > 0 && ids[r.ID] {
+			return fmt.Errorf("rule id %q is not unique", r.ID)
+		}
+		ids[r.ID] = true
+
+		if r.Status != "Enabled" && r.Status != "Disabled" {
+			return fmt.Errorf("invalid rule status %q", r.Status)
+		}
+		if r.Prefix != nil && r.Filter != nil {
+			return fmt.Errorf("rule can not have both prefix and filter")
+		}
+		if r.Filter != nil {
+			if err := r.Filter.validate(); err != nil {
+				return err
+			}
+		}
+		if r.Expiration == nil && r.NoncurrentVersionExpiration == nil {
+			return fmt.Errorf("rule %q has no action", r.ID)
+		}
+		if e := r.Expiration; e != nil {
+			set := 0
+			if e.Days != 0 {
+				set++
+			}
+			if len(e.Date) > 0 {
+				set++
+			}
+			if e.ExpiredObjectDeleteMarker {
+				set++
+			}
+			if set != 1 {
+				return fmt.Errorf("expiration requires exactly one of days, date or expired object delete marker")
+			}
+			if e.Days < 0 {
+				return fmt.Errorf("expiration days must be a positive integer")
+			}
+			if len(e.Date) > 0 {
+				if _, err := time.Parse(time.RFC3339, e.Date); err != nil {
+					return fmt.Errorf("invalid expiration date %q", e.Date)
+				}
+			}
+		}
+		if e := r.NoncurrentVersionExpiration; e != nil {
+			if e.NoncurrentDays <= 0 {
+				return fmt.Errorf("noncurrent days must be a positive integer")
+			}
+			if e.NewerNoncurrentVersions < 0 || e.NewerNoncurrentVersions > 100 {
+				return fmt.Errorf("newer noncurrent versions must be between 1 and 100")
+			}
+		}
+	}
+	return nil
+}
+
+func (f *LifecycleFilter) validate() error {
+	set := 0
+	if f.Prefix != nil {
+		set++
+	}
+	if f.Tag != nil {
+		set++
+	}
+	if f.ObjectSizeGreaterThan != 0 {
+		set++
+	}
+	if f.ObjectSizeLessThan != 0 {
+		set++
+	}
+	if f.And != nil {
+		set++
+	}
+	if set > 1 {
+		return fmt.Errorf("filter conditions have to be combined with And")
+	}
+	if f.And != nil && f.And.ObjectSizeLessThan != 0 && f.And.ObjectSizeLessThan <= f.And.ObjectSizeGreaterThan {
+		return fmt.Errorf("ObjectSizeLessThan must be greater than ObjectSizeGreaterThan")
+	}
+	return nil
+}
+
+// Matches reports whether the rule is enabled and its filter selects a
+// version with the key, tags and size.
+func (r *LifecycleRule) Matches(key string, tags map[string]string, size int64) bool {
+	if r.Status != "Enabled" {
+		return false
+	}
+	if r.Prefix != nil {
+		return strings.HasPrefix(key, *r.Prefix)
+	}
+
+	f := r.Filter
+	if f == nil {
+		return true
+	}
+	if f.Prefix != nil && !strings.HasPrefix(key, *f.Prefix) {
+		return false
+	}
+	if f.Tag != nil && !hasTag(tags, *f.Tag) {
+		return false
+	}
+	if !matchSize(size, f.ObjectSizeGreaterThan, f.ObjectSizeLessThan) {
+		return false
+	}
+	if a := f.And; a != nil {
+		if !strings.HasPrefix(key, a.Prefix) {
+			return false
+		}
+		for _, tag := range a.Tags {
+			if !hasTag(tags, tag) {
+				return false
+			}
+		}
+		if !matchSize(size, a.ObjectSizeGreaterThan, a.ObjectSizeLessThan) {
+			return false
+		}
+	}
+	return true
+}
+
+// Expired reports whether the current version created at lastModified is
+// due for expiration.
+func (r *LifecycleRule) Expired(lastModified time.Time, now time.Time) bool {
+	e := r.Expiration
+	if e == nil {
+		return false
+	}
+	if e.Days > 0 {
+		return !now.Before(lastModified.AddDate(0, 0, e.Days))
+	}
+	if len(e.Date) > 0 {
+		date, err := time.Parse(time.RFC3339, e.Date)
+		return err == nil && !now.Before(date)
+	}
+	return false
+}
+
+// NoncurrentExpired reports whether a version noncurrent since the given
+// time is due for expiration. newer is the number of noncurrent versions
+// which are newer than the version.
+func (r *LifecycleRule) NoncurrentExpired(noncurrentSince time.Time, newer int, now time.Time) bool {
+	e := r.NoncurrentVersionExpiration
+	if e == nil || newer < e.NewerNoncurrentVersions {
+		return false
+	}
+	return !now.Before(noncurrentSince.AddDate(0, 0, e.NoncurrentDays))
+}
+
+func hasTag(tags map[string]string, tag Tag) bool {
+	v, ok := tags[tag.Key]
+	return ok && v == tag.Value
+}
+
+func matchSize(size int64, greaterThan int64, lessThan int64) bool {
+	if greaterThan > 0 && size <= greaterThan {
+		return false
+	}
+	if lessThan > 0 && size >= lessThan {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestLifecycleConfiguration(t *testing.T) {
+	body := `<LifecycleConfiguration>
+		<Rule>
+			<ID>build-outputs</ID>
+			<Filter>
+				<And>
+					<Prefix>tmp/</Prefix>
+					<Tag><Key>kind</Key><Value>build</Value></Tag>
+					<ObjectSizeGreaterThan>10</ObjectSizeGreaterThan>
+				</And>
+			</Filter>
+			<Status>Enabled</Status>
+			<Expiration><Days>7</Days></Expiration>
+			<NoncurrentVersionExpiration><NoncurrentDays>1</NoncurrentDays><NewerNoncurrentVersions>2</NewerNoncurrentVersions></NoncurrentVersionExpiration>
+		</Rule>
+	</LifecycleConfiguration>`
+
+	var config LifecycleConfiguration
+	if err := xml.Unmarshal([]byte(body), &config); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("result was incorrect\ngot: %v\n\nwant: nil", err)
+	}
+	rule := config.Rules[0]
+
+	tests := []struct {
+		name string
+		key  string
+		tags map[string]string
+		size int64
+		want bool
+	}{
+		{"match", "tmp/a.o", map[string]string{"kind": "build"}, 100, true},
+		{"prefix", "src/a.go", map[string]string{"kind": "build"}, 100, false},
+		{"tag", "tmp/a.o", map[string]string{"kind": "release"}, 100, false},
+		{"untagged", "tmp/a.o", nil, 100, false},
+		{"size", "tmp/a.o", map[string]string{"kind": "build"}, 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := rule.Matches(tt.key, tt.tags, tt.size); result != tt.want {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", result, tt.want)
+			}
+		})
+	}
+
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("expired", func(t *testing.T) {
+		if rule.Expired(created, created.AddDate(0, 0, 6)) {
+			t.Error("object expired after 6 days")
+		}
+		if !rule.Expired(created, created.AddDate(0, 0, 7)) {
+			t.Error("object not expired after 7 days")
+		}
+	})
+
+	t.Run("noncurrent", func(t *testing.T) {
+		if rule.NoncurrentExpired(created, 1, created.AddDate(0, 0, 2)) {
+			t.Error("retained noncurrent version expired")
+		}
+		if !rule.NoncurrentExpired(created, 2, created.AddDate(0, 0, 2)) {
+			t.Error("noncurrent version not expired")
+		}
+		if rule.NoncurrentExpired(created, 2, created.Add(time.Hour)) {
+			t.Error("noncurrent version expired too early")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		disabled := rule
+		disabled.Status = "Disabled"
+		if disabled.Matches("tmp/a.o", map[string]string{"kind": "build"}, 100) {
+			t.Error("disabled rule matched")
+		}
+	})
+}
+
+func TestLifecycleConfigurationValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"no rules", `<LifecycleConfiguration></LifecycleConfiguration>`},
+		{"no action", `<LifecycleConfiguration><Rule><Status>Enabled</Status></Rule></LifecycleConfiguration>`},
+		{"status", `<LifecycleConfiguration><Rule><Status>On</Status><Expiration><Days>1</Days></Expiration></Rule></LifecycleConfiguration>`},
+		{"days and date", `<LifecycleConfiguration><Rule><Status>Enabled</Status><Expiration><Days>1</Days><Date>2030-01-01T00:00:00Z</Date></Expiration></Rule></LifecycleConfiguration>`},
+		{"filter without and", `<LifecycleConfiguration><Rule><Status>Enabled</Status><Filter><Prefix>a</Prefix><Tag><Key>k</Key><Value>v</Value></Tag></Filter><Expiration><Days>1</Days></Expiration></Rule></LifecycleConfiguration>`},
+		{"duplicate id", `<LifecycleConfiguration><Rule><ID>a</ID><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule><Rule><ID>a</ID><Status>Enabled</Status><Expiration><Days>2</Days></Expiration></Rule></LifecycleConfiguration>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config LifecycleConfiguration
+			if err := xml.Unmarshal([]byte(tt.body), &config); err != nil {
+				t.Fatal(err)
+			}
+			if err := config.Validate(); err == nil {
+				t.Error("invalid configuration accepted")
+			}
+		})
+	}
+}
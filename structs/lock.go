@@ -0,0 +1,41 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+const keyLockStripes = 1024
+
+// KeyLocks serializes the changes of a key and its version index. Keys
+// are hashed onto a fixed number of locks, so keys sharing a lock wait
+// for each other and a lock must not be taken while holding another.
+// The zero value is ready to use.
+type KeyLocks struct {
+	stripes [keyLockStripes]sync.RWMutex
+}
+
+func (l *KeyLocks) stripe(bucket string, key string) *sync.RWMutex {
+	h := fnv.New32a()
+	h.Write([]byte(bucket))
+	h.Write([]byte{'/'})
+	h.Write([]byte(key))
+	return &l.stripes[h.Sum32()%keyLockStripes]
+}
+
+// Lock locks key for writing and returns the function unlocking it.
+func (l *KeyLocks) Lock(bucket string, key string) func() {
+	m := l.stripe(bucket, key)
+	m.Lock()
+	return m.Unlock
+}
+
+// RLock locks key for reading and returns the function unlocking it.
+func (l *KeyLocks) RLock(bucket string, key string) func() {
+	m := l.stripe(bucket, key)
+	m.RLock()
+	return m.RUnlock
+}
@@ -0,0 +1,521 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrStorageFull = errors.New("storage is full")
+
+// MemoryBackend keeps everything in memory, nothing survives a restart.
+// Object data is limited to maxBytes unless it is 0.
+type MemoryBackend struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	buckets  map[string]*memoryBucket
+	metadata map[string][]byte
+}
+
+type memoryBucket struct {
+	created  time.Time
+	objects  map[string]*memoryObject
+	archived map[string]map[string]*memoryObject
+	dirs     map[string]time.Time
+	indexes  map[string][]byte
+}
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemoryBackend(maxBytes int64) *MemoryBackend {
+	return &MemoryBackend{
+		maxBytes: maxBytes,
+		buckets:  make(map[string]*memoryBucket),
+		metadata: make(map[string][]byte),
+	}
+}
+
+func notExist(op string, path string) error {
+	return &fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist}
+}
+
+func (m *MemoryBackend) bucket(bucket string) (*memoryBucket, error) {
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return nil, notExist("stat", bucket)
+	}
+	return b, nil
+}
+
+// isDir reports whether dir was created or is the parent of a key.
+func (b *memoryBucket) isDir(dir string) bool {
+	dir = strings.TrimSuffix(dir, "/")
+	if len(dir) == 0 {
+		return true
+	}
+	if _, ok := b.dirs[dir]; ok {
+		return true
+	}
+	for key := range b.objects {
+		if strings.HasPrefix(key, dir+"/") {
+			return true
+		}
+	}
+	for d := range b.dirs {
+		if strings.HasPrefix(d, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryBackend) ListBuckets() ([]BucketInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buckets := []BucketInfo{}
+	for name, b := range m.buckets {
+		buckets = append(buckets, BucketInfo{Name: name, CreationDate: b.created})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Name < buckets[j].Name })
+	return buckets, nil
+}
+
+func (m *MemoryBackend) CreateBucket(bucket string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(bucket) == 0 || strings.Contains(bucket, "/") {
+		return &fs.PathError{Op: "mkdir", Path: bucket, Err: fs.ErrInvalid}
+	}
+	if _, ok := m.buckets[bucket]; ok {
+		return &fs.PathError{Op: "mkdir", Path: bucket, Err: fs.ErrExist}
+	}
+	m.buckets[bucket] = &memoryBucket{
+		created:  time.Now(),
+		objects:  make(map[string]*memoryObject),
+		archived: make(map[string]map[string]*memoryObject),
+		dirs:     make(map[string]time.Time),
+		indexes:  make(map[string][]byte),
+	}
+	return nil
+}
+
+func (m *MemoryBackend) HeadBucket(bucket string) (BucketInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, err := m.bucket(bucket)
+	if err != nil {
+		return BucketInfo{}, err
+	}
+	return BucketInfo{Name: bucket, CreationDate: b.created}, nil
+}
+
+func (m *MemoryBackend) DeleteBucket(bucket string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, err := m.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	if len(b.objects) > 0 || len(b.dirs) > 0 || len(b.indexes) > 0 {
+		return ErrBucketNotEmpty
+	}
+
+	delete(m.buckets, bucket)
+	for name := range m.metadata {
+		if strings.HasPrefix(name, "buckets/"+bucket+"/") {
+			delete(m.metadata, name)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryBackend) StatObject(bucket string, key string) (ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, err := m.bucket(bucket)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	name := key[strings.LastIndex(strings.TrimSuffix(key, "/"), "/")+1:]
+	if o, ok := b.objects[key]; ok {
+		return ObjectInfo{Name: name, Size: int64(len(o.data)), ModTime: o.modTime}, nil
+	}
+	if b.isDir(key) {
+		if len(key) == 0 {
+			return ObjectInfo{Name: bucket, ModTime: b.created, IsDir: true}, nil
+		}
+		return ObjectInfo{Name: strings.TrimSuffix(name, "/"), ModTime: b.dirs[strings.TrimSuffix(key, "/")], IsDir: true}, nil
+	}
+	return ObjectInfo{}, notExist("stat", key)
+}
+
+func (m *MemoryBackend) ListDir(bucket string, dir string) ([]ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, err := m.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !b.isDir(dir) {
+		return nil, notExist("open", dir)
+	}
+
+	objects := make([]ObjectInfo, 0, len(b.objects))
+	for key, o := range b.objects {
+		objects = append(objects, ObjectInfo{Name: key, Size: int64(len(o.data)), ModTime: o.modTime})
+	}
+	return listKeyDir(objects, b.dirs, dir), nil
+}
+
+func (m *MemoryBackend) ListKeys(bucket string, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, err := m.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			found[key] = true
+		}
+	}
+	for key := range b.indexes {
+		if strings.HasPrefix(key, prefix) {
+			found[key] = true
+		}
+	}
+
+	keys := make([]string, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *MemoryBackend) object(bucket string, key string, versionID string) (*memoryObject, error) {
+	b, err := m.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	o, ok := b.objects[key]
+	if len(versionID) > 0 {
+		o, ok = b.archived[key][versionID]
+	}
+	if !ok {
+		return nil, notExist("open", key)
+	}
+	return o, nil
+}
+
+func (m *MemoryBackend) OpenObject(bucket string, key string, versionID string) (io.ReadSeekCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, err := m.object(bucket, key, versionID)
+	if err != nil {
+		return nil, err
+	}
+	// data is never modified, replacing an object swaps the slice
+	return readSeekNopCloser{bytes.NewReader(o.data)}, nil
+}
+
+type readSeekNopCloser struct {
+	io.ReadSeeker
+}
+
+func (readSeekNopCloser) Close() error { return nil }
+
+func (m *MemoryBackend) CreateObject(bucket string, key string) (ObjectWriter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.bucket(bucket); err != nil {
+		return nil, err
+	}
+	if len(key) == 0 || strings.HasSuffix(key, "/") {
+		return nil, &fs.PathError{Op: "open", Path: key, Err: fs.ErrInvalid}
+	}
+	return &memoryWriter{m: m, bucket: bucket, key: key}, nil
+}
+
+// memoryWriter reserves the written bytes and replaces the latest data of
+// the key on Commit.
+type memoryWriter struct {
+	m      *MemoryBackend
+	bucket string
+	key    string
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (w *memoryWriter) Write(p []byte) (int, error) {
+	w.m.mu.Lock()
+	defer w.m.mu.Unlock()
+
+	if w.closed {
+		return 0, fs.ErrClosed
+	}
+	if w.m.maxBytes > 0 && w.m.size+int64(len(p)) > w.m.maxBytes {
+		return 0, ErrStorageFull
+	}
+	w.m.size += int64(len(p))
+	return w.buf.Write(p)
+}
+
+func (w *memoryWriter) Commit() error {
+	w.m.mu.Lock()
+	defer w.m.mu.Unlock()
+
+	if w.closed {
+		return fs.ErrClosed
+	}
+	w.closed = true
+
+	b, err := w.m.bucket(w.bucket)
+	if err != nil {
+		w.m.size -= int64(w.buf.Len())
+		return err
+	}
+	if old, ok := b.objects[w.key]; ok {
+		w.m.size -= int64(len(old.data))
+	}
+	b.objects[w.key] = &memoryObject{data: w.buf.Bytes(), modTime: time.Now()}
+	return nil
+}
+
+func (w *memoryWriter) Abort() error {
+	w.m.mu.Lock()
+	defer w.m.mu.Unlock()
+
+	if !w.closed {
+		w.closed = true
+		w.m.size -= int64(w.buf.Len())
+	}
+	return nil
+}
+
+func (m *MemoryBackend) ArchiveObject(bucket string, key string, versionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, err := m.object(bucket, key, "")
+	if err != nil {
+		return err
+	}
+	b := m.buckets[bucket]
+	if b.archived[key] == nil {
+		b.archived[key] = make(map[string]*memoryObject)
+	}
+	if old, ok := b.archived[key][versionID]; ok {
+		m.size -= int64(len(old.data))
+	}
+	b.archived[key][versionID] = o
+	delete(b.objects, key)
+	return nil
+}
+
+func (m *MemoryBackend) RestoreObject(bucket string, key string, versionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, err := m.object(bucket, key, versionID)
+	if err != nil {
+		return err
+	}
+	b := m.buckets[bucket]
+	if old, ok := b.objects[key]; ok {
+		m.size -= int64(len(old.data))
+	}
+	b.objects[key] = o
+	delete(b.archived[key], versionID)
+	if len(b.archived[key]) == 0 {
+		delete(b.archived, key)
+	}
+	return nil
+}
+
+func (m *MemoryBackend) RemoveObject(bucket string, key string, versionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, err := m.object(bucket, key, versionID)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.size -= int64(len(o.data))
+	b := m.buckets[bucket]
+	if len(versionID) == 0 {
+		delete(b.objects, key)
+		return nil
+	}
+	delete(b.archived[key], versionID)
+	if len(b.archived[key]) == 0 {
+		delete(b.archived, key)
+	}
+	return nil
+}
+
+func (m *MemoryBackend) MakeDir(bucket string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, err := m.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	dir := strings.TrimSuffix(key, "/")
+	if b.isDir(dir) {
+		return &fs.PathError{Op: "mkdir", Path: key, Err: fs.ErrExist}
+	}
+	b.dirs[dir] = time.Now()
+	return nil
+}
+
+func (m *MemoryBackend) RemoveDir(bucket string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, err := m.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	dir := strings.TrimSuffix(key, "/")
+	for k, o := range b.objects {
+		if strings.HasPrefix(k, dir+"/") {
+			m.size -= int64(len(o.data))
+			delete(b.objects, k)
+		}
+	}
+	for d := range b.dirs {
+		if d == dir || strings.HasPrefix(d, dir+"/") {
+			delete(b.dirs, d)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryBackend) ReadObjectIndex(bucket string, key string) (*ObjectIndex, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, err := m.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := b.indexes[key]
+	if !ok {
+		return nil, notExist("open", key)
+	}
+	idx := &ObjectIndex{Key: key}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("corrupt metadata of %s/%s: %v", bucket, key, err)
+	}
+	return idx, nil
+}
+
+func (m *MemoryBackend) WriteObjectIndex(bucket string, idx *ObjectIndex) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, err := m.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	if len(idx.Versions) == 0 {
+		delete(b.indexes, idx.Key)
+		for _, o := range b.archived[idx.Key] {
+			m.size -= int64(len(o.data))
+		}
+		delete(b.archived, idx.Key)
+		return nil
+	}
+
+	// stored marshaled so callers can not modify it
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	b.indexes[idx.Key] = data
+	return nil
+}
+
+func (m *MemoryBackend) CreateMultipartUpload(uploadID string, key string, meta *ObjectMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.metadata[uploadID+".json"] = data
+	m.metadata[uploadID+"/"+key] = []byte{}
+	return nil
+}
+
+func (m *MemoryBackend) ReadMetadata(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.metadata[name]
+	if !ok {
+		return nil, notExist("open", name)
+	}
+	return bytes.Clone(data), nil
+}
+
+func (m *MemoryBackend) WriteMetadata(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.metadata[name] = bytes.Clone(data)
+	return nil
+}
+
+func (m *MemoryBackend) DeleteMetadata(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.metadata, name)
+	return nil
+}
+
+func (m *MemoryBackend) ListMetadata(dir string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := []string{}
+	for name := range m.metadata {
+		if rest, ok := strings.CutPrefix(name, dir+"/"); ok && !strings.Contains(rest, "/") {
+			names = append(names, rest)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMemoryBackendMaxBytes(t *testing.T) {
+	b := NewMemoryBackend(10)
+	if err := b.CreateBucket("photos"); err != nil {
+		t.Fatal(err)
+	}
+
+	writeObject(t, b, "photos", "a.jpg", "123456")
+	w, err := b.CreateObject("photos", "b.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "123456"); !errors.Is(err, ErrStorageFull) {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, ErrStorageFull)
+	}
+	w.Abort()
+
+	// replacing and removing data releases its bytes
+	writeObject(t, b, "photos", "a.jpg", "1234")
+	if err := b.RemoveObject("photos", "b.jpg", ""); err != nil {
+		t.Fatal(err)
+	}
+	writeObject(t, b, "photos", "b.jpg", "123456")
+	if b.size != 10 {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", b.size, 10)
+	}
+}
+
+func TestMemoryBackendListDir(t *testing.T) {
+	b := NewMemoryBackend(0)
+	if err := b.CreateBucket("photos"); err != nil {
+		t.Fatal(err)
+	}
+	writeObject(t, b, "photos", "a.jpg", "a")
+	writeObject(t, b, "photos", "2023/b.jpg", "b")
+	writeObject(t, b, "photos", "2023/06/c.jpg", "c")
+	if err := b.MakeDir("photos", "2024/"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dir  string
+		want []string
+	}{
+		{"", []string{"2023/", "2024/", "a.jpg"}},
+		{"2023/", []string{"06/", "b.jpg"}},
+		{"2023", []string{"06/", "b.jpg"}},
+		{"2024/", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			infos, err := b.ListDir("photos", tt.dir)
+			got := []string{}
+			for _, info := range infos {
+				if info.IsDir {
+					info.Name += "/"
+				}
+				got = append(got, info.Name)
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v", got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := b.ListDir("photos", "a.jpg"); err == nil {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, "not exist")
+	}
+	if err := b.RemoveDir("photos", "2023/"); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := b.ListKeys("photos", "")
+	if got := strings.Join(keys, ","); got != "a.jpg" {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", got, "a.jpg")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"time"
+)
+
+// ObjectIndex is the metadata sidecar of a key. Versions are ordered
+// newest first, the first entry is the latest version.
+type ObjectIndex struct {
+	Key      string
+	Versions []ObjectMeta
+}
+
+type ObjectMeta struct {
+	VersionID    string
+	DeleteMarker bool `json:",omitempty"`
+	ETag         string
+	Size         int64
+	LastModified time.Time
+	ContentType  string            `json:",omitempty"`
+	UserMetadata map[string]string `json:",omitempty"`
+	LockMode     string            `json:",omitempty"`
+	RetainUntil  time.Time
+	LegalHold    bool              `json:",omitempty"`
+	Tags         map[string]string `json:",omitempty"`
+
+	WebsiteRedirectLocation string `json:",omitempty"`
+	ReplicationStatus       string `json:",omitempty"`
+
+	// server side encryption algorithm and the wrapped data key, with
+	// customer provided keys only a salted hash of the key is kept
+	SSE                  string `json:",omitempty"`
+	SSEKey               string `json:",omitempty"`
+	SSEKMSKeyID          string `json:",omitempty"`
+	SSEContext           string `json:",omitempty"`
+	SSECustomerAlgorithm string `json:",omitempty"`
+	SSECustomerKeyHash   string `json:",omitempty"`
+}
+
+// Locked reports whether object lock protects the version from deletion.
+// Governance mode retention can be bypassed.
+func (m *ObjectMeta) Locked(bypassGovernance bool, now time.Time) bool {
+	if m.DeleteMarker {
+		return false
+	}
+	if m.LegalHold {
+		return true
+	}
+	if !now.Before(m.RetainUntil) {
+		return false
+	}
+	return m.LockMode == "COMPLIANCE" || !bypassGovernance
+}
+
+// Latest returns the latest version or nil if the key has no versions.
+func (idx *ObjectIndex) Latest() *ObjectMeta {
+	if len(idx.Versions) == 0 {
+		return nil
+	}
+	return &idx.Versions[0]
+}
+
+// Find returns the position of a version or -1.
+func (idx *ObjectIndex) Find(versionID string) int {
+	for i, v := range idx.Versions {
+		if v.VersionID == versionID {
+			return i
+		}
+	}
+	return -1
+}
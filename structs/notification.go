@@ -0,0 +1,219 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const QueueArnPrefix = "arn:aws:sqs:us-east-1:000000000000:"
+
+// WebhookTarget is a notification destination from the local targets file:
+//
+//	[{"Name": "ingest", "Endpoint": "https://ingest.example.com/events", "AuthToken": "secret"}]
+//
+// Buckets reference it by the queue ARN arn:aws:sqs:us-east-1:000000000000:ingest.
+type WebhookTarget struct {
+	Name      string
+	Endpoint  string
+	AuthToken string
+}
+
+// Arn returns the queue ARN of the target.
+func (t *WebhookTarget) Arn() string {
+	return QueueArnPrefix + t.Name
+}
+
+func LoadWebhookTargets(path string) (map[string]*WebhookTarget, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []WebhookTarget
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("can not parse %s: %v", path, err)
+	}
+
+	targets := make(map[string]*WebhookTarget)
+	for i := range list {
+		t := &list[i]
+		if len(t.Name) == 0 || strings.ContainsAny(t.Name, ":/") {
+			return nil, fmt.Errorf("invalid target name %q", t.Name)
+		}
+		u, err := url.Parse(t.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return nil, fmt.Errorf("target %s needs an http or https endpoint", t.Name)
+		}
+		if _, ok := targets[t.Arn()]; ok {
+			return nil, fmt.Errorf("duplicate target %s", t.Name)
+		}
+		targets[t.Arn()] = t
+	}
+	return targets, nil
+}
+
+// notificationEvents are the supported event types, wildcards match all
+// events with their prefix.
+var notificationEvents = map[string]bool{
+	"s3:ObjectCreated:*":                       true,
+	"s3:ObjectCreated:Put":                     true,
+	"s3:ObjectCreated:Post":                    true,
+	"s3:ObjectCreated:Copy":                    true,
+	"s3:ObjectCreated:CompleteMultipartUpload": true,
+	"s3:ObjectRemoved:*":                       true,
+	"s3:ObjectRemoved:Delete":                  true,
+	"s3:ObjectRemoved:DeleteMarkerCreated":     true,
+}
+
+// Validate checks events, filters and that every queue is a known target.
+func (c *NotificationConfiguration) Validate(targets map[string]*WebhookTarget) error {
+	ids := make(map[string]bool)
+	for _, q := range c.QueueConfigurations {
+		if _, ok := targets[q.Queue]; !ok {
+			return fmt.Errorf("unknown notification target %s", q.Queue)
+		}
+		if len(q.Id) > 0 {
+			if ids[q.Id] {
+				return fmt.Errorf("duplicate configuration id %s", q.Id)
+			}
+			ids[q.Id] = true
+		}
+		if len(q.Events) == 0 {
+			return fmt.Errorf("configuration for %s has no events", q.Queue)
+		}
+		for _, event := range q.Events {
+			if !notificationEvents[event] {
+				return fmt.Errorf("unsupported event %s", event)
+			}
+		}
+		if q.Filter == nil {
+			continue
+		}
+		names := make(map[string]bool)
+		for _, rule := range q.Filter.FilterRules {
+			name := strings.ToLower(rule.Name)
+			if name != "prefix" && name != "suffix" {
+				return fmt.Errorf("filter rule name must be prefix or suffix")
+			}
+			if names[name] {
+				return fmt.Errorf("duplicate %s filter rule", name)
+			}
+			names[name] = true
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the event of key is delivered to the queue.
+func (q *QueueConfiguration) Matches(event string, key string) bool {
+	if q.Filter != nil {
+		for _, rule := range q.Filter.FilterRules {
+			switch strings.ToLower(rule.Name) {
+			case "prefix":
+				if !strings.HasPrefix(key, rule.Value) {
+					return false
+				}
+			case "suffix":
+				if !strings.HasSuffix(key, rule.Value) {
+					return false
+				}
+			}
+		}
+	}
+
+	for _, e := range q.Events {
+		if e == event {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(e, "*"); ok && strings.HasPrefix(event, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the S3 event message format, the event name has no s3: prefix.
+type Event struct {
+	Records []EventRecord
+}
+
+type EventRecord struct {
+	EventVersion      string            `json:"eventVersion"`
+	EventSource       string            `json:"eventSource"`
+	AwsRegion         string            `json:"awsRegion"`
+	EventTime         string            `json:"eventTime"`
+	EventName         string            `json:"eventName"`
+	UserIdentity      EventIdentity     `json:"userIdentity"`
+	RequestParameters map[string]string `json:"requestParameters"`
+	ResponseElements  map[string]string `json:"responseElements"`
+	S3                EventS3           `json:"s3"`
+}
+
+type EventIdentity struct {
+	PrincipalId string `json:"principalId"`
+}
+
+type EventS3 struct {
+	SchemaVersion   string      `json:"s3SchemaVersion"`
+	ConfigurationId string      `json:"configurationId"`
+	Bucket          EventBucket `json:"bucket"`
+	Object          EventObject `json:"object"`
+}
+
+type EventBucket struct {
+	Name          string        `json:"name"`
+	OwnerIdentity EventIdentity `json:"ownerIdentity"`
+	Arn           string        `json:"arn"`
+}
+
+type EventObject struct {
+	Key       string `json:"key"`
+	Size      int64  `json:"size,omitempty"`
+	ETag      string `json:"eTag,omitempty"`
+	VersionId string `json:"versionId,omitempty"`
+	Sequencer string `json:"sequencer"`
+}
+
+// NewEventRecord creates the record of event on a version of key. Like S3
+// the key is form encoded keeping slashes and the sequencer orders events
+// of the same key.
+func NewEventRecord(event string, bucket string, key string, meta *ObjectMeta, principal string, sourceIP string, now time.Time) EventRecord {
+	object := EventObject{
+		Key:       strings.ReplaceAll(url.QueryEscape(key), "%2F", "/"),
+		Sequencer: fmt.Sprintf("%016X", now.UnixNano()),
+	}
+	if meta != nil {
+		object.Size = meta.Size
+		object.ETag = strings.Trim(meta.ETag, "\"")
+		if meta.VersionID != "null" {
+			object.VersionId = meta.VersionID
+		}
+	}
+
+	return EventRecord{
+		EventVersion:      "2.1",
+		EventSource:       "aws:s3",
+		AwsRegion:         "us-east-1",
+		EventTime:         now.UTC().Format("2006-01-02T15:04:05.000Z"),
+		EventName:         strings.TrimPrefix(event, "s3:"),
+		UserIdentity:      EventIdentity{PrincipalId: principal},
+		RequestParameters: map[string]string{"sourceIPAddress": sourceIP},
+		ResponseElements:  map[string]string{},
+		S3: EventS3{
+			SchemaVersion: "1.0",
+			Bucket: EventBucket{
+				Name:          bucket,
+				OwnerIdentity: EventIdentity{PrincipalId: principal},
+				Arn:           "arn:aws:s3:::" + bucket,
+			},
+			Object: object,
+		},
+	}
+}
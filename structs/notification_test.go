@@ -0,0 +1,85 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotificationValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	os.WriteFile(path, []byte(`[{"Name": "ingest", "Endpoint": "http://localhost:8080/events"}]`), 0600)
+
+	targets, err := LoadWebhookTargets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := "arn:aws:sqs:us-east-1:000000000000:ingest"
+	tests := []struct {
+		name   string
+		config QueueConfiguration
+		valid  bool
+	}{
+		{"valid", QueueConfiguration{Queue: queue, Events: []string{"s3:ObjectCreated:*"}}, true},
+		{"filter", QueueConfiguration{Queue: queue, Events: []string{"s3:ObjectRemoved:Delete"}, Filter: &NotificationFilter{FilterRules: []FilterRule{{"Prefix", "logs/"}, {"Suffix", ".gz"}}}}, true},
+		{"unknown target", QueueConfiguration{Queue: QueueArnPrefix + "other", Events: []string{"s3:ObjectCreated:*"}}, false},
+		{"no events", QueueConfiguration{Queue: queue}, false},
+		{"unsupported event", QueueConfiguration{Queue: queue, Events: []string{"s3:ObjectRestore:*"}}, false},
+		{"filter name", QueueConfiguration{Queue: queue, Events: []string{"s3:ObjectCreated:*"}, Filter: &NotificationFilter{FilterRules: []FilterRule{{"Contains", "a"}}}}, false},
+		{"duplicate filter", QueueConfiguration{Queue: queue, Events: []string{"s3:ObjectCreated:*"}, Filter: &NotificationFilter{FilterRules: []FilterRule{{"prefix", "a"}, {"Prefix", "b"}}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NotificationConfiguration{QueueConfigurations: []QueueConfiguration{tt.config}}
+			err := c.Validate(targets)
+			if (err == nil) != tt.valid {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestNotificationMatches(t *testing.T) {
+	q := QueueConfiguration{
+		Events: []string{"s3:ObjectCreated:*", "s3:ObjectRemoved:Delete"},
+		Filter: &NotificationFilter{FilterRules: []FilterRule{{"prefix", "logs/"}, {"suffix", ".gz"}}},
+	}
+
+	tests := []struct {
+		event string
+		key   string
+		want  bool
+	}{
+		{"s3:ObjectCreated:Put", "logs/a.gz", true},
+		{"s3:ObjectCreated:Copy", "logs/b.gz", true},
+		{"s3:ObjectRemoved:Delete", "logs/a.gz", true},
+		{"s3:ObjectRemoved:DeleteMarkerCreated", "logs/a.gz", false},
+		{"s3:ObjectCreated:Put", "data/a.gz", false},
+		{"s3:ObjectCreated:Put", "logs/a.txt", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event+" "+tt.key, func(t *testing.T) {
+			if got := q.Matches(tt.event, tt.key); got != tt.want {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEventRecord(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	meta := &ObjectMeta{VersionID: "null", ETag: "\"abc\"", Size: 5}
+
+	r := NewEventRecord("s3:ObjectCreated:Put", "bucket", "a b/c", meta, "user", "127.0.0.1", now)
+	if r.EventName != "ObjectCreated:Put" || r.EventTime != "2024-05-01T12:00:00.000Z" {
+		t.Errorf("result was incorrect\ngot: %v %v\n\nwant: ObjectCreated:Put 2024-05-01T12:00:00.000Z", r.EventName, r.EventTime)
+	}
+	if r.S3.Object.Key != "a+b/c" || r.S3.Object.ETag != "abc" || r.S3.Object.VersionId != "" {
+		t.Errorf("result was incorrect\ngot: %+v\n\nwant: a+b/c abc", r.S3.Object)
+	}
+}
@@ -0,0 +1,390 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOIDCAudience is the audience tokens must have if none is configured.
+const DefaultOIDCAudience = "sts.amazonaws.com"
+
+var ErrTokenExpired = errors.New("token is expired")
+
+// OIDCProvider validates web identity tokens against a JWKS file or the
+// keys published by the issuer and maps their claims to policies.
+type OIDCProvider struct {
+	Issuer   string
+	Audience string
+	JWKSFile string
+	Rules    []OIDCPolicyRule
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	refreshed time.Time
+}
+
+// OIDCPolicyRule grants Policy to tokens whose Claim matches Value. Value
+// may contain * and ? wildcards, list claims like groups match any element.
+type OIDCPolicyRule struct {
+	Claim  string
+	Value  string
+	Policy IAMPolicy
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func NewOIDCProvider(issuer string, audience string, jwksFile string, policyFile string) (*OIDCProvider, error) {
+	if len(audience) == 0 {
+		audience = DefaultOIDCAudience
+	}
+	p := &OIDCProvider{
+		Issuer:   strings.TrimSuffix(issuer, "/"),
+		Audience: audience,
+		JWKSFile: jwksFile,
+	}
+
+	if len(p.Issuer) == 0 && len(p.JWKSFile) == 0 {
+		return nil, fmt.Errorf("either issuer or jwks file is required")
+	}
+
+	if len(policyFile) > 0 {
+		b, err := os.ReadFile(policyFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &p.Rules); err != nil {
+			return nil, fmt.Errorf("can not parse %s: %v", policyFile, err)
+		}
+	}
+
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Verify checks signature, issuer, audience and lifetime of the token and
+// returns its claims.
+func (p *OIDCProvider) Verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token is not a JWT")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	key, err := p.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature")
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); !ok || now.After(time.Unix(int64(exp), 0)) {
+		return nil, ErrTokenExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+	if len(p.Issuer) > 0 && claims["iss"] != p.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if !ClaimValues(claims, "aud")[p.Audience] {
+		return nil, fmt.Errorf("unexpected audience %v", claims["aud"])
+	}
+
+	return claims, nil
+}
+
+// Policies returns the policies of all rules matching the claims.
+func (p *OIDCProvider) Policies(claims map[string]any) []IAMPolicy {
+	policies := []IAMPolicy{}
+	for _, rule := range p.Rules {
+		for value := range ClaimValues(claims, rule.Claim) {
+			if WildcardMatch(rule.Value, value) {
+				policies = append(policies, rule.Policy)
+				break
+			}
+		}
+	}
+	return policies
+}
+
+// ClaimValues returns a string or string list claim as a set.
+func ClaimValues(claims map[string]any, claim string) map[string]bool {
+	values := make(map[string]bool)
+	switch v := claims[claim].(type) {
+	case string:
+		values[v] = true
+	case []any:
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				values[s] = true
+			}
+		}
+	}
+	return values
+}
+
+func (p *OIDCProvider) key(kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+
+	// keys are rotated, reload at most every 30 seconds
+	if time.Since(p.refreshed) > 30*time.Second {
+		if err := p.load(); err != nil {
+			log.Printf("can not reload web identity keys: %v", err)
+		}
+	}
+
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (p *OIDCProvider) lookup(kid string) (crypto.PublicKey, bool) {
+	if key, ok := p.keys[kid]; ok {
+		return key, true
+	}
+	// tokens without kid are accepted if there is a single key
+	if len(kid) == 0 && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func (p *OIDCProvider) refresh() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.load()
+}
+
+func (p *OIDCProvider) load() error {
+	p.refreshed = time.Now()
+
+	var b []byte
+	var err error
+	if len(p.JWKSFile) > 0 {
+		b, err = os.ReadFile(p.JWKSFile)
+	} else {
+		b, err = fetchJWKS(p.Issuer)
+	}
+	if err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &jwks); err != nil {
+		return fmt.Errorf("can not parse jwks: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("skipping jwk %s: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("jwks contains no usable keys")
+	}
+
+	p.keys = keys
+	return nil
+}
+
+func fetchJWKS(issuer string) ([]byte, error) {
+	client := http.Client{Timeout: 10 * time.Second}
+
+	get := func(url string) ([]byte, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	}
+
+	b, err := get(issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(b, &discovery); err != nil || len(discovery.JWKSURI) == 0 {
+		return nil, fmt.Errorf("issuer %s has no jwks_uri", issuer)
+	}
+	return get(discovery.JWKSURI)
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("point is not on curve")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"):
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match algorithm %s", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, signature); err != nil {
+			return fmt.Errorf("invalid token signature")
+		}
+	case strings.HasPrefix(alg, "PS"):
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match algorithm %s", alg)
+		}
+		if err := rsa.VerifyPSS(pub, hash, digest, signature, nil); err != nil {
+			return fmt.Errorf("invalid token signature")
+		}
+	case strings.HasPrefix(alg, "ES"):
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match algorithm %s", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("invalid token signature")
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("malformed token")
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("malformed token")
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOIDCProvider(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "k1",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	os.WriteFile(filepath.Join(dir, "jwks.json"), jwks, 0600)
+	os.WriteFile(filepath.Join(dir, "policies.json"), []byte(`[
+		{"Claim": "sub", "Value": "system:serviceaccount:ci:*", "Policy": {"Statement": [{"Effect": "Allow", "Action": "s3:*", "Resource": "arn:aws:s3:::builds/*"}]}},
+		{"Claim": "groups", "Value": "admins", "Policy": {"Statement": [{"Effect": "Allow", "Action": "s3:*", "Resource": "*"}]}}
+	]`), 0600)
+
+	p, err := NewOIDCProvider("https://kubernetes.default.svc", "s3-go", filepath.Join(dir, "jwks.json"), filepath.Join(dir, "policies.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(kid string, claims map[string]any) string {
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+		payload, _ := json.Marshal(claims)
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(signed))
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+
+	claims := func() map[string]any {
+		return map[string]any{
+			"iss": "https://kubernetes.default.svc",
+			"aud": []string{"s3-go"},
+			"sub": "system:serviceaccount:ci:builder",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		c, err := p.Verify(sign("k1", claims()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		policies := p.Policies(c)
+		if len(policies) != 1 || !policies[0].IsAllowed("s3:PutObject", "arn:aws:s3:::builds/a") {
+			t.Errorf("result was incorrect\ngot: %v", policies)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		c := claims()
+		c["exp"] = time.Now().Add(-time.Minute).Unix()
+		if _, err := p.Verify(sign("k1", c)); !errors.Is(err, ErrTokenExpired) {
+			t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, ErrTokenExpired)
+		}
+	})
+
+	t.Run("audience", func(t *testing.T) {
+		c := claims()
+		c["aud"] = "sts.amazonaws.com"
+		if _, err := p.Verify(sign("k1", c)); err == nil {
+			t.Error("token for other audience accepted")
+		}
+	})
+
+	t.Run("default audience", func(t *testing.T) {
+		d, err := NewOIDCProvider("https://kubernetes.default.svc", "", filepath.Join(dir, "jwks.json"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Verify(sign("k1", claims())); err == nil {
+			t.Error("token for other audience accepted")
+		}
+		c := claims()
+		c["aud"] = DefaultOIDCAudience
+		if _, err := d.Verify(sign("k1", c)); err != nil {
+			t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, nil)
+		}
+	})
+
+	t.Run("signature", func(t *testing.T) {
+		token := sign("k1", claims())
+		if _, err := p.Verify(token[:len(token)-4] + "AAAA"); err == nil {
+			t.Error("tampered token accepted")
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		if _, err := p.Verify(sign("k2", claims())); err == nil {
+			t.Error("token with unknown key accepted")
+		}
+	})
+}
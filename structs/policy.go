@@ -0,0 +1,231 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrEntityTooSmall = errors.New("EntityTooSmall")
+var ErrEntityTooLarge = errors.New("EntityTooLarge")
+
+type PostPolicy struct {
+	Expiration time.Time
+	Conditions []PostPolicyCondition
+}
+
+type PostPolicyCondition struct {
+	Operator string
+	Field    string
+	Value    string
+	Min      int64
+	Max      int64
+}
+
+// PostPolicyIgnored lists the form fields a POST policy does not have to cover.
+var PostPolicyIgnored = map[string]bool{
+	"awsaccesskeyid":  true,
+	"bucket":          true,
+	"file":            true,
+	"policy":          true,
+	"signature":       true,
+	"x-amz-signature": true,
+}
+
+func ParsePostPolicy(policy string) (*PostPolicy, error) {
+	b, err := base64.StdEncoding.DecodeString(policy)
+	if err != nil {
+		return nil, fmt.Errorf("policy is not base64 encoded")
+	}
+
+	var raw struct {
+		Expiration string `json:"expiration"`
+		Conditions []any  `json:"conditions"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("policy is not valid json")
+	}
+
+	expiration, err := time.Parse(time.RFC3339, raw.Expiration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy expiration")
+	}
+
+	p := &PostPolicy{Expiration: expiration}
+	for _, c := range raw.Conditions {
+		switch v := c.(type) {
+		case map[string]any:
+			for field, value := range v {
+				s, ok := value.(string)
+				if !ok {
+					return nil, fmt.Errorf("invalid condition for %s", field)
+				}
+				p.Conditions = append(p.Conditions, PostPolicyCondition{Operator: "eq", Field: strings.ToLower(field), Value: s})
+			}
+		case []any:
+			if len(v) != 3 {
+				return nil, fmt.Errorf("invalid condition %v", v)
+			}
+			op, _ := v[0].(string)
+			switch strings.ToLower(op) {
+			case "eq", "starts-with":
+				field, ok1 := v[1].(string)
+				value, ok2 := v[2].(string)
+				if !ok1 || !ok2 || !strings.HasPrefix(field, "$") {
+					return nil, fmt.Errorf("invalid condition %v", v)
+				}
+				p.Conditions = append(p.Conditions, PostPolicyCondition{
+					Operator: strings.ToLower(op),
+					Field:    strings.ToLower(strings.TrimPrefix(field, "$")),
+					Value:    value,
+				})
+			case "content-length-range":
+				min, ok1 := v[1].(float64)
+				max, ok2 := v[2].(float64)
+				if !ok1 || !ok2 || min > max {
+					return nil, fmt.Errorf("invalid content-length-range %v", v)
+				}
+				p.Conditions = append(p.Conditions, PostPolicyCondition{Operator: "content-length-range", Min: int64(min), Max: int64(max)})
+			default:
+				return nil, fmt.Errorf("unknown condition %s", op)
+			}
+		default:
+			return nil, fmt.Errorf("invalid condition %v", c)
+		}
+	}
+
+	return p, nil
+}
+
+// Check validates the form fields against the policy. Field names are
+// expected in lower case. Every field except the ignored ones and
+// x-ignore-* must be matched by a condition.
+func (p *PostPolicy) Check(fields map[string]string, now time.Time) error {
+	if now.After(p.Expiration) {
+		return fmt.Errorf("policy expired")
+	}
+
+	covered := make(map[string]bool)
+	for _, c := range p.Conditions {
+		switch c.Operator {
+		case "eq":
+			if fields[c.Field] != c.Value {
+				return fmt.Errorf("policy condition failed: [\"eq\", \"$%s\", \"%s\"]", c.Field, c.Value)
+			}
+		case "starts-with":
+			if c.Field == "content-type" {
+				// content-type may hold a comma separated list
+				for _, v := range strings.Split(fields[c.Field], ",") {
+					if !strings.HasPrefix(strings.TrimSpace(v), c.Value) {
+						return fmt.Errorf("policy condition failed: [\"starts-with\", \"$%s\", \"%s\"]", c.Field, c.Value)
+					}
+				}
+			} else if !strings.HasPrefix(fields[c.Field], c.Value) {
+				return fmt.Errorf("policy condition failed: [\"starts-with\", \"$%s\", \"%s\"]", c.Field, c.Value)
+			}
+		default:
+			continue
+		}
+		covered[c.Field] = true
+	}
+
+	for field := range fields {
+		if PostPolicyIgnored[field] || strings.HasPrefix(field, "x-ignore-") || covered[field] {
+			continue
+		}
+		return fmt.Errorf("extra input fields: %s", field)
+	}
+
+	return nil
+}
+
+// CheckContentLength validates size against a content-length-range condition.
+func (p *PostPolicy) CheckContentLength(size int64) error {
+	for _, c := range p.Conditions {
+		if c.Operator != "content-length-range" {
+			continue
+		}
+		if size < c.Min {
+			return ErrEntityTooSmall
+		}
+		if size > c.Max {
+			return ErrEntityTooLarge
+		}
+	}
+	return nil
+}
+
+// MaxContentLength returns the upper bound of the content-length-range
+// condition or -1 if the policy has none.
+func (p *PostPolicy) MaxContentLength() int64 {
+	for _, c := range p.Conditions {
+		if c.Operator == "content-length-range" {
+			return c.Max
+		}
+	}
+	return -1
+}
+
+// ContentLengthReader checks the content-length-range condition while body
+// is read. Reading fails once the body is too large or, instead of ending,
+// when it is too small.
+func (p *PostPolicy) ContentLengthReader(body io.Reader) io.Reader {
+	return &contentLengthReader{r: body, policy: p, max: p.MaxContentLength()}
+}
+
+type contentLengthReader struct {
+	r      io.Reader
+	policy *PostPolicy
+	max    int64
+	size   int64
+}
+
+func (c *contentLengthReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.size += int64(n)
+	if c.max >= 0 && c.size > c.max {
+		return n, ErrEntityTooLarge
+	}
+	if err == io.EOF {
+		if err := c.policy.CheckContentLength(c.size); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+func (app *App) ValidPostPolicySignature(fields map[string]string) (*Credentials, bool) {
+	if accessKey, ok := fields["awsaccesskeyid"]; ok && app.SignatureV2 != nil && *app.SignatureV2 {
+		credentials, ok := app.LookupCredentials(accessKey, fields["x-amz-security-token"])
+		if !ok || !hmac.Equal([]byte(signatureV2(credentials.SecretKey, fields["policy"])), []byte(fields["signature"])) {
+			return nil, false
+		}
+		return credentials, true
+	}
+
+	if fields["x-amz-algorithm"] != "AWS4-HMAC-SHA256" {
+		return nil, false
+	}
+
+	headers := map[string]string{"Credential": fields["x-amz-credential"]}
+	accessKey, _, _ := strings.Cut(headers["Credential"], "/")
+	credentials, ok := app.LookupCredentials(accessKey, fields["x-amz-security-token"])
+	if !ok {
+		return nil, false
+	}
+
+	signature := signingKeySignature(credentials.SecretKey, fields["policy"], headers)
+	if signature == "" || !hmac.Equal([]byte(signature), []byte(fields["x-amz-signature"])) {
+		return nil, false
+	}
+
+	return credentials, true
+}
@@ -0,0 +1,67 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// BucketQuota limits the stored bytes and object versions of a bucket,
+// zero means unlimited. Usage is only part of responses.
+type BucketQuota struct {
+	XMLName    xml.Name     `xml:"BucketQuota"`
+	MaxBytes   int64        `xml:"MaxBytes,omitempty"`
+	MaxObjects int64        `xml:"MaxObjects,omitempty"`
+	Usage      *BucketUsage `xml:"Usage,omitempty"`
+}
+
+// BucketUsage counts the versions of a bucket and their size, delete
+// markers are not counted.
+type BucketUsage struct {
+	Bytes   int64
+	Objects int64
+}
+
+func (q *BucketQuota) Validate() error {
+	if q.MaxBytes < 0 || q.MaxObjects < 0 {
+		return fmt.Errorf("quota must not be negative")
+	}
+	return nil
+}
+
+// IndexUsage returns the usage of the versions of a key.
+func IndexUsage(idx *ObjectIndex) BucketUsage {
+	var u BucketUsage
+	for _, v := range idx.Versions {
+		if !v.DeleteMarker {
+			u.Bytes += v.Size
+			u.Objects++
+		}
+	}
+	return u
+}
+
+func (u BucketUsage) Add(other BucketUsage) BucketUsage {
+	return BucketUsage{Bytes: u.Bytes + other.Bytes, Objects: u.Objects + other.Objects}
+}
+
+func (u BucketUsage) Sub(other BucketUsage) BucketUsage {
+	return BucketUsage{Bytes: u.Bytes - other.Bytes, Objects: u.Objects - other.Objects}
+}
+
+// Remaining returns how many bytes one more object may have with usage,
+// -1 if bytes are unlimited. ok is false if no object fits.
+func (q *BucketQuota) Remaining(usage BucketUsage) (bytes int64, ok bool) {
+	if q.MaxObjects > 0 && usage.Objects+1 > q.MaxObjects {
+		return 0, false
+	}
+	if q.MaxBytes == 0 {
+		return -1, true
+	}
+	if usage.Bytes > q.MaxBytes {
+		return 0, false
+	}
+	return q.MaxBytes - usage.Bytes, true
+}
@@ -0,0 +1,41 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"testing"
+)
+
+func TestIndexUsage(t *testing.T) {
+	idx := &ObjectIndex{Versions: []ObjectMeta{{Size: 10}, {DeleteMarker: true}, {Size: 5}}}
+	want := BucketUsage{Bytes: 15, Objects: 2}
+	if got := IndexUsage(idx); got != want {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", got, want)
+	}
+}
+
+func TestQuotaRemaining(t *testing.T) {
+	tests := []struct {
+		name  string
+		quota BucketQuota
+		usage BucketUsage
+		bytes int64
+		ok    bool
+	}{
+		{"unlimited", BucketQuota{}, BucketUsage{100, 10}, -1, true},
+		{"bytes", BucketQuota{MaxBytes: 100}, BucketUsage{60, 1}, 40, true},
+		{"bytes full", BucketQuota{MaxBytes: 100}, BucketUsage{100, 1}, 0, true},
+		{"bytes exceeded", BucketQuota{MaxBytes: 100}, BucketUsage{101, 1}, 0, false},
+		{"objects", BucketQuota{MaxObjects: 2}, BucketUsage{60, 1}, -1, true},
+		{"objects full", BucketQuota{MaxObjects: 2, MaxBytes: 100}, BucketUsage{60, 2}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bytes, ok := tt.quota.Remaining(tt.usage)
+			if bytes != tt.bytes || ok != tt.ok {
+				t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v %v", bytes, ok, tt.bytes, tt.ok)
+			}
+		})
+	}
+}
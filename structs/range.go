@@ -0,0 +1,61 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidRange = errors.New("the requested range is not satisfiable")
+
+// ParseRange parses a single byte range of a Range header for an object
+// of size bytes. Like S3, malformed headers and multiple ranges are ignored
+// and the whole object is returned, ok is false then.
+func ParseRange(header string, size int64) (start int64, length int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, size, false, nil
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, size, false, nil
+	}
+
+	if len(first) == 0 {
+		// suffix range of the last bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, size, false, nil
+		}
+		// an empty object has no last bytes
+		if n == 0 || size == 0 {
+			return 0, 0, false, ErrInvalidRange
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size, false, nil
+	}
+	end := size - 1
+	if len(last) > 0 {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, size, false, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return 0, 0, false, ErrInvalidRange
+	}
+	return start, end - start + 1, true, nil
+}
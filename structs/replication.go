@@ -0,0 +1,157 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReplicationTarget is a replication destination from the local targets
+// file, either another S3 endpoint or a directory like the mount of a
+// second instance:
+//
+//	[{"Name": "dr", "Endpoint": "https://dr.example.com:3000", "Region": "us-east-1", "AccessKey": "user", "SecretKey": "password"},
+//	 {"Name": "backup", "Path": "/mnt/backup"}]
+//
+// Replication rules select the target by the Account of their destination.
+type ReplicationTarget struct {
+	Name      string
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Path      string
+}
+
+func LoadReplicationTargets(path string) (map[string]*ReplicationTarget, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []ReplicationTarget
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("can not parse %s: %v", path, err)
+	}
+
+	targets := make(map[string]*ReplicationTarget)
+	for i := range list {
+		t := &list[i]
+		if len(t.Name) == 0 {
+			return nil, fmt.Errorf("replication target without Name")
+		}
+		if _, ok := targets[t.Name]; ok {
+			return nil, fmt.Errorf("duplicate target %s", t.Name)
+		}
+		switch {
+		case len(t.Endpoint) > 0 && len(t.Path) > 0:
+			return nil, fmt.Errorf("target %s needs either an Endpoint or a Path", t.Name)
+		case len(t.Endpoint) > 0:
+			u, err := url.Parse(t.Endpoint)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+				return nil, fmt.Errorf("target %s needs an http or https endpoint", t.Name)
+			}
+			if len(t.Region) == 0 {
+				t.Region = "us-east-1"
+			}
+		case len(t.Path) > 0:
+			if !filepath.IsAbs(t.Path) {
+				return nil, fmt.Errorf("path of target %s must be absolute", t.Name)
+			}
+		default:
+			return nil, fmt.Errorf("target %s needs an Endpoint or a Path", t.Name)
+		}
+		targets[t.Name] = t
+	}
+	return targets, nil
+}
+
+// DestinationBucket returns the bucket name of the destination ARN.
+func (d *ReplicationDestination) DestinationBucket() string {
+	return strings.TrimPrefix(d.Bucket, "arn:aws:s3:::")
+}
+
+// Validate checks the rules and that every destination is a known target.
+func (c *ReplicationConfiguration) Validate(targets map[string]*ReplicationTarget) error {
+	if len(c.Rules) == 0 {
+		return fmt.Errorf("replication configuration has no rules")
+	}
+
+	ids := make(map[string]bool)
+	priorities := make(map[int]bool)
+	for _, r := range c.Rules {
+		if len(r.ID) > 255 {
+			return fmt.Errorf("rule id is longer than 255 characters")
+		}
+		if len(r.ID) > 0 {
+			if ids[r.ID] {
+				return fmt.Errorf("duplicate rule id %s", r.ID)
+			}
+			ids[r.ID] = true
+		}
+		if priorities[r.Priority] && r.Filter != nil {
+			return fmt.Errorf("rules with filters need distinct priorities")
+		}
+		priorities[r.Priority] = true
+		if r.Status != "Enabled" && r.Status != "Disabled" {
+			return fmt.Errorf("rule status must be Enabled or Disabled")
+		}
+		if r.Prefix != nil && r.Filter != nil {
+			return fmt.Errorf("rule can not have both Prefix and Filter")
+		}
+		if r.Filter != nil {
+			if err := r.Filter.validate(); err != nil {
+				return err
+			}
+			if r.Filter.ObjectSizeGreaterThan != 0 || r.Filter.ObjectSizeLessThan != 0 || (r.Filter.And != nil && (r.Filter.And.ObjectSizeGreaterThan != 0 || r.Filter.And.ObjectSizeLessThan != 0)) {
+				return fmt.Errorf("replication filters do not support object size")
+			}
+		}
+		if !strings.HasPrefix(r.Destination.Bucket, "arn:aws:s3:::") || len(r.Destination.DestinationBucket()) == 0 {
+			return fmt.Errorf("destination bucket must be a bucket ARN")
+		}
+		if _, ok := targets[r.Destination.Account]; !ok {
+			return fmt.Errorf("unknown replication target %q", r.Destination.Account)
+		}
+		if r.DeleteMarkerReplication != nil {
+			switch r.DeleteMarkerReplication.Status {
+			case "Enabled":
+				if r.Filter != nil && (r.Filter.Tag != nil || (r.Filter.And != nil && len(r.Filter.And.Tags) > 0)) {
+					return fmt.Errorf("delete marker replication is not supported with tag filters")
+				}
+			case "Disabled":
+			default:
+				return fmt.Errorf("delete marker replication status must be Enabled or Disabled")
+			}
+		}
+	}
+	return nil
+}
+
+// Match returns the enabled rule with the highest priority that selects a
+// version with key and tags, or nil.
+func (c *ReplicationConfiguration) Match(key string, tags map[string]string) *ReplicationRule {
+	var match *ReplicationRule
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		filter := LifecycleRule{Status: r.Status, Prefix: r.Prefix, Filter: r.Filter}
+		if !filter.Matches(key, tags, 0) {
+			continue
+		}
+		if match == nil || r.Priority > match.Priority {
+			match = r
+		}
+	}
+	return match
+}
+
+// ReplicatesDeleteMarkers reports whether delete markers are replicated.
+func (r *ReplicationRule) ReplicatesDeleteMarkers() bool {
+	return r.DeleteMarkerReplication != nil && r.DeleteMarkerReplication.Status == "Enabled"
+}
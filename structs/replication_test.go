@@ -0,0 +1,91 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadReplicationTargets(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		valid bool
+	}{
+		{"endpoint", `[{"Name": "dr", "Endpoint": "http://localhost:3001", "AccessKey": "user", "SecretKey": "password"}]`, true},
+		{"path", `[{"Name": "backup", "Path": "/mnt/backup"}]`, true},
+		{"relative path", `[{"Name": "backup", "Path": "backup"}]`, false},
+		{"both", `[{"Name": "dr", "Endpoint": "http://localhost:3001", "Path": "/mnt/backup"}]`, false},
+		{"none", `[{"Name": "dr"}]`, false},
+		{"duplicate", `[{"Name": "dr", "Path": "/a"}, {"Name": "dr", "Path": "/b"}]`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "targets.json")
+			os.WriteFile(path, []byte(tt.file), 0600)
+			_, err := LoadReplicationTargets(path)
+			if (err == nil) != tt.valid {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestReplicationValidate(t *testing.T) {
+	targets := map[string]*ReplicationTarget{"dr": {Name: "dr", Path: "/mnt/dr"}}
+	logs := "logs/"
+	destination := ReplicationDestination{Bucket: "arn:aws:s3:::backup", Account: "dr"}
+
+	tests := []struct {
+		name  string
+		rule  ReplicationRule
+		valid bool
+	}{
+		{"valid", ReplicationRule{Status: "Enabled", Prefix: &logs, Destination: destination}, true},
+		{"filter", ReplicationRule{Status: "Enabled", Filter: &LifecycleFilter{Tag: &Tag{"a", "b"}}, Destination: destination}, true},
+		{"status", ReplicationRule{Status: "On", Destination: destination}, false},
+		{"unknown target", ReplicationRule{Status: "Enabled", Destination: ReplicationDestination{Bucket: "arn:aws:s3:::backup", Account: "other"}}, false},
+		{"bucket arn", ReplicationRule{Status: "Enabled", Destination: ReplicationDestination{Bucket: "backup", Account: "dr"}}, false},
+		{"size filter", ReplicationRule{Status: "Enabled", Filter: &LifecycleFilter{ObjectSizeGreaterThan: 10}, Destination: destination}, false},
+		{"delete markers with tags", ReplicationRule{Status: "Enabled", Filter: &LifecycleFilter{Tag: &Tag{"a", "b"}}, Destination: destination, DeleteMarkerReplication: &DeleteMarkerReplication{"Enabled"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := ReplicationConfiguration{Rules: []ReplicationRule{tt.rule}}
+			err := c.Validate(targets)
+			if (err == nil) != tt.valid {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestReplicationMatch(t *testing.T) {
+	logs, all := "logs/", ""
+	c := ReplicationConfiguration{Rules: []ReplicationRule{
+		{ID: "all", Priority: 1, Status: "Enabled", Prefix: &all},
+		{ID: "logs", Priority: 2, Status: "Enabled", Filter: &LifecycleFilter{Prefix: &logs}},
+		{ID: "tagged", Priority: 3, Status: "Disabled", Filter: &LifecycleFilter{Tag: &Tag{"a", "b"}}},
+	}}
+
+	tests := []struct {
+		key  string
+		tags map[string]string
+		want string
+	}{
+		{"logs/a", nil, "logs"},
+		{"data/a", nil, "all"},
+		{"data/a", map[string]string{"a": "b"}, "all"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got := c.Match(tt.key, tt.tags)
+			if got == nil || got.ID != tt.want {
+				t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,21 +4,28 @@
 package structs
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
 	"strings"
+	"unicode/utf8"
 )
 
+// MaxKeyLength is the longest object key in bytes.
+const MaxKeyLength = 1024
+
+var ErrKeyTooLong = errors.New("key is longer than 1024 bytes")
+var ErrInvalidKey = errors.New("key is not valid UTF-8")
+
 type Request struct {
-	Bucket string
-	Key    string
-	Path   string
+	Bucket    string
+	Key       string
+	VersionID string
 }
 
 func (app *App) ParseRequest(r *http.Request) (*Request, error) {
-	var bucket, key, path string
+	var bucket, key string
 
 	urlPath, found := strings.CutPrefix(r.URL.Path, "/")
 	if !found {
@@ -29,39 +36,46 @@ func (app *App) ParseRequest(r *http.Request) (*Request, error) {
 		return nil, fmt.Errorf("bucket missing")
 	}
 
-	uPath, err := url.QueryUnescape(urlPath)
-	if err != nil {
-		return nil, fmt.Errorf("can not unescape url")
-	}
-
-	split := strings.Split(uPath, "/")
+	// the path is unescaped already, keys may contain % and +
+	split := strings.Split(urlPath, "/")
 	switch len(split) {
 	case 0:
 		return nil, fmt.Errorf("bucket missing")
 	case 1:
 		bucket = split[0]
 		key = ""
-		path = strings.Join([]string{*app.Mount, bucket}, "/")
 	default:
 		bucket = split[0]
-		key, _ = strings.CutPrefix(uPath, bucket+"/")
-		path = strings.Join([]string{*app.Mount, bucket, key}, "/")
-		log.Printf(">>> bucket: %s, key: %s, path: %s, split: %v\n", bucket, key, path, split)
+		key, _ = strings.CutPrefix(urlPath, bucket+"/")
+		log.Printf(">>> bucket: %s, key: %s, split: %v\n", bucket, key, split)
+	}
+	if err := ValidateKey(key); err != nil {
+		return nil, err
 	}
 
 	// check prefix
 	prefix := r.URL.Query().Get("prefix")
 	if len(prefix) > 0 {
 		key = prefix
-		path = strings.Join([]string{*app.Mount, bucket, key}, "/")
 	}
 
 	req := Request{
-		Bucket: bucket,
-		Key:    key,
-		Path:   path,
+		Bucket:    bucket,
+		Key:       key,
+		VersionID: r.URL.Query().Get("versionId"),
 	}
 
-	log.Printf(">>> bucket: %s, key: %s, prefix: %v, path: %s, split: %v\n", req.Bucket, req.Key, len(prefix) > 0, req.Path, len(split))
+	log.Printf(">>> bucket: %s, key: %s, prefix: %v, split: %v\n", req.Bucket, req.Key, len(prefix) > 0, len(split))
 	return &req, nil
 }
+
+// ValidateKey checks that key is UTF-8 of at most MaxKeyLength bytes.
+func ValidateKey(key string) error {
+	if len(key) > MaxKeyLength {
+		return ErrKeyTooLong
+	}
+	if !utf8.ValidString(key) {
+		return ErrInvalidKey
+	}
+	return nil
+}
@@ -9,7 +9,6 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
 )
 
 func (app *App) RespondXML(w http.ResponseWriter, code int, payload any) error {
@@ -39,7 +38,7 @@ func (app *App) Respond(w http.ResponseWriter, code int, headers map[string]stri
 	return nil
 }
 
-func (app *App) RespondFile(w http.ResponseWriter, code int, headers map[string]string, file *os.File) error {
+func (app *App) RespondFile(w http.ResponseWriter, code int, headers map[string]string, file io.ReadCloser) error {
 	if len(headers) > 0 {
 		for k, v := range headers {
 			w.Header().Set(k, v)
@@ -69,6 +68,9 @@ func (app *App) RespondError(w http.ResponseWriter, httpcode int, awscode string
 	}
 
 	log.Print(">>>", err)
+	if lw, ok := w.(*AccessLogWriter); ok {
+		lw.ErrorCode = awscode
+	}
 
 	out, _ := xml.MarshalIndent(e, " ", "  ")
 	w.Header().Set("Content-Type", "application/xml")
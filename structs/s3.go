@@ -59,8 +59,9 @@ type Owner struct {
 }
 
 type VersioningConfiguration struct {
-	XMLName xml.Name `xml:"VersioningConfiguration"`
-	Status  string   `xml:"Status"`
+	XMLName   xml.Name `xml:"VersioningConfiguration"`
+	Status    string   `xml:"Status,omitempty"`
+	MfaDelete string   `xml:"MfaDelete,omitempty"`
 }
 
 type CopyObjectResponse struct {
@@ -75,13 +76,14 @@ type ListVersionsResult struct {
 	Prefix              string
 	KeyMarker           string
 	NextKeyMarker       string `xml:"NextKeyMarker,omitempty"`
-	NextVersionIDMarker string `xml:"NextVersionIdMarker"`
+	NextVersionIDMarker string `xml:"NextVersionIdMarker,omitempty"`
 	VersionIDMarker     string `xml:"VersionIdMarker"`
 	MaxKeys             int
 	Delimiter           string `xml:"Delimiter,omitempty"`
 	IsTruncated         bool
 	CommonPrefixes      []CommonPrefix
 	Version             []ObjectVersion
+	DeleteMarker        []DeleteMarkerEntry
 	EncodingType        string `xml:"EncodingType,omitempty"`
 }
 
@@ -89,14 +91,27 @@ type ObjectVersion struct {
 	Object
 	IsLatest       bool
 	VersionID      string `xml:"VersionId"`
-	isDeleteMarker bool
+	IsDeleteMarker bool   `xml:"-"`
+}
+
+type DeleteMarkerEntry struct {
+	Key          string
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool
+	LastModified string
+	Owner        *Owner `xml:"Owner,omitempty"`
 }
 
 type Delete struct {
-	Objects []Object `xml:"Object"`
+	Objects []ObjectIdentifier `xml:"Object"`
 	Quiet   bool
 }
 
+type ObjectIdentifier struct {
+	Key       string
+	VersionID string `xml:"VersionId"`
+}
+
 type DeleteObjectsResponse struct {
 	XMLName        xml.Name        `xml:"DeleteObjectsResponse"`
 	DeletedObjects []DeletedObject `xml:"Deleted,omitempty"`
@@ -123,3 +138,213 @@ type InitiateMultipartUploadResponse struct {
 	Key      string
 	UploadID string `xml:"UploadId"`
 }
+
+type PostResponse struct {
+	XMLName  xml.Name `xml:"PostResponse"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+type ObjectLockConfiguration struct {
+	XMLName           xml.Name        `xml:"ObjectLockConfiguration"`
+	ObjectLockEnabled string          `xml:"ObjectLockEnabled,omitempty"`
+	Rule              *ObjectLockRule `xml:"Rule,omitempty"`
+}
+
+type ObjectLockRule struct {
+	DefaultRetention DefaultRetention
+}
+
+type DefaultRetention struct {
+	Mode  string
+	Days  int `xml:"Days,omitempty"`
+	Years int `xml:"Years,omitempty"`
+}
+
+type Retention struct {
+	XMLName         xml.Name `xml:"Retention"`
+	Mode            string   `xml:"Mode,omitempty"`
+	RetainUntilDate string   `xml:"RetainUntilDate,omitempty"`
+}
+
+type LegalHold struct {
+	XMLName xml.Name `xml:"LegalHold"`
+	Status  string
+}
+
+type LifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration"`
+	Rules   []LifecycleRule `xml:"Rule"`
+}
+
+type LifecycleRule struct {
+	ID                          string `xml:"ID,omitempty"`
+	Status                      string
+	Prefix                      *string                      `xml:"Prefix,omitempty"`
+	Filter                      *LifecycleFilter             `xml:"Filter,omitempty"`
+	Expiration                  *LifecycleExpiration         `xml:"Expiration,omitempty"`
+	NoncurrentVersionExpiration *NoncurrentVersionExpiration `xml:"NoncurrentVersionExpiration,omitempty"`
+}
+
+type LifecycleFilter struct {
+	Prefix                *string       `xml:"Prefix,omitempty"`
+	Tag                   *Tag          `xml:"Tag,omitempty"`
+	ObjectSizeGreaterThan int64         `xml:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    int64         `xml:"ObjectSizeLessThan,omitempty"`
+	And                   *LifecycleAnd `xml:"And,omitempty"`
+}
+
+type LifecycleAnd struct {
+	Prefix                string `xml:"Prefix,omitempty"`
+	Tags                  []Tag  `xml:"Tag"`
+	ObjectSizeGreaterThan int64  `xml:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    int64  `xml:"ObjectSizeLessThan,omitempty"`
+}
+
+type LifecycleExpiration struct {
+	Days                      int    `xml:"Days,omitempty"`
+	Date                      string `xml:"Date,omitempty"`
+	ExpiredObjectDeleteMarker bool   `xml:"ExpiredObjectDeleteMarker,omitempty"`
+}
+
+type NoncurrentVersionExpiration struct {
+	NoncurrentDays          int `xml:"NoncurrentDays"`
+	NewerNoncurrentVersions int `xml:"NewerNoncurrentVersions,omitempty"`
+}
+
+type Tag struct {
+	Key   string
+	Value string
+}
+
+type CORSConfiguration struct {
+	XMLName   xml.Name   `xml:"CORSConfiguration"`
+	CORSRules []CORSRule `xml:"CORSRule"`
+}
+
+type CORSRule struct {
+	ID             string   `xml:"ID,omitempty"`
+	AllowedHeaders []string `xml:"AllowedHeader"`
+	AllowedMethods []string `xml:"AllowedMethod"`
+	AllowedOrigins []string `xml:"AllowedOrigin"`
+	ExposeHeaders  []string `xml:"ExposeHeader"`
+	MaxAgeSeconds  int      `xml:"MaxAgeSeconds,omitempty"`
+}
+
+type Tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	TagSet  []Tag    `xml:"TagSet>Tag"`
+}
+
+type WebsiteConfiguration struct {
+	XMLName               xml.Name               `xml:"WebsiteConfiguration"`
+	RedirectAllRequestsTo *RedirectAllRequestsTo `xml:"RedirectAllRequestsTo,omitempty"`
+	IndexDocument         *IndexDocument         `xml:"IndexDocument,omitempty"`
+	ErrorDocument         *ErrorDocument         `xml:"ErrorDocument,omitempty"`
+	RoutingRules          []RoutingRule          `xml:"RoutingRules>RoutingRule,omitempty"`
+}
+
+type RedirectAllRequestsTo struct {
+	HostName string
+	Protocol string `xml:"Protocol,omitempty"`
+}
+
+type IndexDocument struct {
+	Suffix string
+}
+
+type ErrorDocument struct {
+	Key string
+}
+
+type RoutingRule struct {
+	Condition *RoutingRuleCondition `xml:"Condition,omitempty"`
+	Redirect  Redirect
+}
+
+type RoutingRuleCondition struct {
+	KeyPrefixEquals             string `xml:"KeyPrefixEquals,omitempty"`
+	HttpErrorCodeReturnedEquals int    `xml:"HttpErrorCodeReturnedEquals,omitempty"`
+}
+
+type Redirect struct {
+	HostName             string `xml:"HostName,omitempty"`
+	HttpRedirectCode     int    `xml:"HttpRedirectCode,omitempty"`
+	Protocol             string `xml:"Protocol,omitempty"`
+	ReplaceKeyPrefixWith string `xml:"ReplaceKeyPrefixWith,omitempty"`
+	ReplaceKeyWith       string `xml:"ReplaceKeyWith,omitempty"`
+}
+
+type ServerSideEncryptionConfiguration struct {
+	XMLName xml.Name                   `xml:"ServerSideEncryptionConfiguration"`
+	Rules   []ServerSideEncryptionRule `xml:"Rule"`
+}
+
+type ServerSideEncryptionRule struct {
+	ApplyServerSideEncryptionByDefault *ServerSideEncryptionByDefault `xml:"ApplyServerSideEncryptionByDefault,omitempty"`
+	BucketKeyEnabled                   bool                           `xml:"BucketKeyEnabled,omitempty"`
+}
+
+type ServerSideEncryptionByDefault struct {
+	SSEAlgorithm   string
+	KMSMasterKeyID string `xml:"KMSMasterKeyID,omitempty"`
+}
+
+type NotificationConfiguration struct {
+	XMLName             xml.Name             `xml:"NotificationConfiguration"`
+	QueueConfigurations []QueueConfiguration `xml:"QueueConfiguration"`
+}
+
+type QueueConfiguration struct {
+	Id     string              `xml:"Id,omitempty"`
+	Queue  string              `xml:"Queue"`
+	Events []string            `xml:"Event"`
+	Filter *NotificationFilter `xml:"Filter,omitempty"`
+}
+
+type NotificationFilter struct {
+	FilterRules []FilterRule `xml:"S3Key>FilterRule"`
+}
+
+type FilterRule struct {
+	Name  string
+	Value string
+}
+
+type ReplicationConfiguration struct {
+	XMLName xml.Name          `xml:"ReplicationConfiguration"`
+	Role    string            `xml:"Role,omitempty"`
+	Rules   []ReplicationRule `xml:"Rule"`
+}
+
+type ReplicationRule struct {
+	ID                      string                   `xml:"ID,omitempty"`
+	Priority                int                      `xml:"Priority,omitempty"`
+	Status                  string                   `xml:"Status"`
+	Prefix                  *string                  `xml:"Prefix,omitempty"`
+	Filter                  *LifecycleFilter         `xml:"Filter,omitempty"`
+	Destination             ReplicationDestination   `xml:"Destination"`
+	DeleteMarkerReplication *DeleteMarkerReplication `xml:"DeleteMarkerReplication,omitempty"`
+}
+
+type ReplicationDestination struct {
+	Bucket       string `xml:"Bucket"`
+	Account      string `xml:"Account,omitempty"`
+	StorageClass string `xml:"StorageClass,omitempty"`
+}
+
+type DeleteMarkerReplication struct {
+	Status string
+}
+
+type BucketLoggingStatus struct {
+	XMLName        xml.Name        `xml:"BucketLoggingStatus"`
+	LoggingEnabled *LoggingEnabled `xml:"LoggingEnabled,omitempty"`
+}
+
+type LoggingEnabled struct {
+	TargetBucket string
+	TargetPrefix string
+}
@@ -11,7 +11,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"time"
 )
 
 func (app *App) ValidSignatureV4(r *http.Request) (bool, *http.Request) {
@@ -32,12 +34,18 @@ func (app *App) ValidSignatureV4(r *http.Request) (bool, *http.Request) {
 		return false, nil
 	}
 
-	stringToSign := stringToSign(canonicalRequest, *app.AccessKey, headers)
+	accessKey, _, _ := strings.Cut(headers["Credential"], "/")
+	credentials, ok := app.LookupCredentials(accessKey, r.Header.Get("X-Amz-Security-Token"))
+	if !ok {
+		return false, nil
+	}
+
+	stringToSign := stringToSign(canonicalRequest, credentials.AccessKey, headers)
 	if stringToSign == "" {
 		return false, nil
 	}
 
-	signature := signingKeySignature(*app.SecretKey, stringToSign, headers)
+	signature := signingKeySignature(credentials.SecretKey, stringToSign, headers)
 	if signature == "" {
 		return false, nil
 	}
@@ -45,7 +53,11 @@ func (app *App) ValidSignatureV4(r *http.Request) (bool, *http.Request) {
 	//log.Print(signature)
 	//log.Print(headers["Signature"])
 
-	return signature == headers["Signature"], r
+	if signature != headers["Signature"] {
+		return false, nil
+	}
+
+	return true, WithCredentials(r, credentials)
 }
 
 func authorizationHeader(header http.Header, host string, req string) map[string]string {
@@ -77,6 +89,10 @@ func authorizationHeader(header http.Header, host string, req string) map[string
 }
 
 func canonicalRequest(method string, requestURI *url.URL, rawQuery string, body []byte, headers map[string]string) string {
+	return canonicalRequestHash(method, requestURI, rawQuery, HexSHA256Hash(body), headers)
+}
+
+func canonicalRequestHash(method string, requestURI *url.URL, rawQuery string, payloadHash string, headers map[string]string) string {
 	signedHeaders := strings.Split(headers["SignedHeaders"], ";")
 
 	canonicalRequest := method + "\n"                                    // <HTTPMethod>
@@ -88,7 +104,7 @@ func canonicalRequest(method string, requestURI *url.URL, rawQuery string, body
 	}
 	canonicalRequest += "\n"
 	canonicalRequest += headers["SignedHeaders"] + "\n" // <SignedHeaders>
-	canonicalRequest += HexSHA256Hash(body)
+	canonicalRequest += payloadHash
 
 	//log.Print(canonicalRequest)
 
@@ -125,6 +141,32 @@ func signingKeySignature(secret string, stringToSign string, headers map[string]
 	return hex.EncodeToString(HmacSHA256(signingKey, []byte(stringToSign)))
 }
 
+// SignV4 signs an outgoing request to the s3 service of region with the
+// hex encoded SHA256 hash of its payload. Host, Content-Type and all
+// x-amz-* headers are signed.
+func SignV4(req *http.Request, payloadHash string, accessKey string, secretKey string, region string, now time.Time) {
+	date := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", date)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	signed := []string{"host"}
+	for k, v := range req.Header {
+		name := strings.ToLower(k)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.Join(v, ",")
+			signed = append(signed, name)
+		}
+	}
+	sort.Strings(signed)
+	headers["SignedHeaders"] = strings.Join(signed, ";")
+	headers["Credential"] = accessKey + "/" + date[:8] + "/" + region + "/s3/aws4_request"
+
+	canonicalRequest := canonicalRequestHash(req.Method, req.URL, req.URL.Query().Encode(), payloadHash, headers)
+	signature := signingKeySignature(secretKey, stringToSign(canonicalRequest, accessKey, headers), headers)
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+headers["Credential"]+", SignedHeaders="+headers["SignedHeaders"]+", Signature="+signature)
+}
+
 func HexSHA256Hash(b []byte) string {
 	bs := sha256.Sum256([]byte(b))
 	return hex.EncodeToString(bs[:])
@@ -0,0 +1,255 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// Encrypted objects are split into chunks of SSEChunkSize bytes, each sealed
+// with AES-256-GCM under the data key of the object. The nonce is the chunk
+// index and the last chunk is authenticated as final, so chunks can neither
+// be reordered nor truncated and every chunk can be decrypted on its own.
+const (
+	SSEChunkSize      = 64 * 1024
+	sseOverhead       = 16
+	sseEncryptedChunk = SSEChunkSize + sseOverhead
+)
+
+// LoadMasterKey reads the 32 byte master key wrapping the data keys of
+// encrypted objects. A missing key file is only created with a random key
+// if create is set, a lost key must not be replaced silently since the
+// objects encrypted with it could no longer be read.
+func LoadMasterKey(path string, create bool) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if os.IsNotExist(err) && create {
+		key = NewDataKey()
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = f.Write(key); err == nil {
+			err = f.Sync()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return nil, err
+		}
+		log.Printf("Master key created at %s", path)
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key %s must be 32 bytes", path)
+	}
+	return key, nil
+}
+
+// NewDataKey returns a random object data key.
+func NewDataKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// WrapKey seals a data key with the master key, the additional data
+// has to be presented again to unwrap it.
+func WrapKey(master []byte, key []byte, additionalData []byte) (string, error) {
+	aead, err := newGCM(master)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, key, additionalData)), nil
+}
+
+// UnwrapKey opens a data key sealed by WrapKey.
+func UnwrapKey(master []byte, wrapped string, additionalData []byte) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < aead.NonceSize() {
+		return nil, errors.New("wrapped key is too short")
+	}
+	key, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, errors.New("can not unwrap data key")
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(index uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], index)
+	return nonce
+}
+
+func chunkAdditionalData(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// EncryptedSize returns the size of the encrypted data of a plaintext size.
+func EncryptedSize(size int64) int64 {
+	chunks := (size + SSEChunkSize - 1) / SSEChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return size + chunks*sseOverhead
+}
+
+type encryptWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	index uint64
+}
+
+// NewEncryptWriter encrypts everything written to it into w. Close seals
+// the final chunk but does not close w.
+func NewEncryptWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, buf: make([]byte, 0, SSEChunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// a full chunk is only sealed once more data follows, the last
+		// chunk has to be marked as final
+		if len(e.buf) == SSEChunkSize {
+			if err := e.seal(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(e.buf[len(e.buf):SSEChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.index), e.buf, chunkAdditionalData(final))
+	e.index++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+type decryptReader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	index uint64
+	final uint64
+	buf   []byte
+	chunk []byte
+}
+
+// NewDecryptReader returns the plaintext of an object of size bytes from
+// offset on. r has to be positioned at the encrypted chunk containing
+// offset, see EncryptedOffset.
+func NewDecryptReader(r io.Reader, key []byte, size int64, offset int64) (io.Reader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	final := uint64(0)
+	if size > 0 {
+		final = uint64((size - 1) / SSEChunkSize)
+	}
+	d := &decryptReader{
+		r:     r,
+		aead:  aead,
+		index: uint64(offset / SSEChunkSize),
+		final: final,
+		chunk: make([]byte, sseEncryptedChunk),
+	}
+	if err := d.next(); err != nil {
+		return nil, err
+	}
+	d.buf = d.buf[offset%SSEChunkSize:]
+	return d, nil
+}
+
+// EncryptedOffset returns where the chunk containing the plaintext offset starts.
+func EncryptedOffset(offset int64) int64 {
+	return offset / SSEChunkSize * sseEncryptedChunk
+}
+
+func (d *decryptReader) next() error {
+	if d.index > d.final {
+		return io.EOF
+	}
+	n, err := io.ReadFull(d.r, d.chunk)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	plain, err := d.aead.Open(d.chunk[:0], chunkNonce(d.index), d.chunk[:n], chunkAdditionalData(d.index == d.final))
+	if err != nil {
+		return errors.New("encrypted object is corrupt")
+	}
+	d.index++
+	d.buf = plain
+	return nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	if len(d.buf) == 0 {
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+		if len(d.buf) == 0 {
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
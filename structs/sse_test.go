@@ -0,0 +1,171 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := NewDataKey()
+
+	for _, size := range []int64{0, 1, SSEChunkSize - 1, SSEChunkSize, SSEChunkSize + 1, 3*SSEChunkSize + 100} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		var encrypted bytes.Buffer
+		w, err := NewEncryptWriter(&encrypted, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// odd write sizes cross chunk boundaries
+		for rest := plain; len(rest) > 0; {
+			n := min(len(rest), 1000)
+			w.Write(rest[:n])
+			rest = rest[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if int64(encrypted.Len()) != EncryptedSize(size) {
+			t.Errorf("size %d: result was incorrect\ngot: %v\n\nwant: %v", size, encrypted.Len(), EncryptedSize(size))
+		}
+
+		for _, offset := range []int64{0, size / 2, size - 1} {
+			if offset < 0 || (offset >= size && size > 0) {
+				continue
+			}
+			data := encrypted.Bytes()[EncryptedOffset(offset):]
+			r, err := NewDecryptReader(bytes.NewReader(data), key, size, offset)
+			if err != nil {
+				t.Fatalf("size %d offset %d: %v", size, offset, err)
+			}
+			result, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("size %d offset %d: %v", size, offset, err)
+			}
+			if !bytes.Equal(result, plain[offset:]) {
+				t.Errorf("size %d offset %d: plaintext differs", size, offset)
+			}
+		}
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	key := NewDataKey()
+	plain := make([]byte, 2*SSEChunkSize+10)
+
+	var encrypted bytes.Buffer
+	w, _ := NewEncryptWriter(&encrypted, key)
+	w.Write(plain)
+	w.Close()
+	size := int64(len(plain))
+
+	t.Run("truncated", func(t *testing.T) {
+		data := encrypted.Bytes()[:2*sseEncryptedChunk]
+		r, err := NewDecryptReader(bytes.NewReader(data), key, size, 0)
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		if err == nil {
+			t.Error("truncated object decrypted")
+		}
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		data := bytes.Clone(encrypted.Bytes())
+		data[5] ^= 1
+		if _, err := NewDecryptReader(bytes.NewReader(data), key, size, 0); err == nil {
+			t.Error("modified object decrypted")
+		}
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		if _, err := NewDecryptReader(bytes.NewReader(encrypted.Bytes()), NewDataKey(), size, 0); err == nil {
+			t.Error("object decrypted with wrong key")
+		}
+	})
+}
+
+func TestLoadMasterKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.key")
+
+	if _, err := LoadMasterKey(path, false); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", err, fs.ErrNotExist)
+	}
+	created, err := LoadMasterKey(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadMasterKey(path, false)
+	if err != nil || !bytes.Equal(loaded, created) {
+		t.Errorf("result was incorrect\ngot: %x %v\n\nwant: %x", loaded, err, created)
+	}
+	if loaded, err := LoadMasterKey(path, true); err != nil || !bytes.Equal(loaded, created) {
+		t.Errorf("result was incorrect\ngot: %x %v\n\nwant: %x", loaded, err, created)
+	}
+}
+
+func TestWrapKey(t *testing.T) {
+	master := NewDataKey()
+	key := NewDataKey()
+
+	wrapped, err := WrapKey(master, key, []byte("context"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := UnwrapKey(master, wrapped, []byte("context"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, key) {
+		t.Errorf("result was incorrect\ngot: %x\n\nwant: %x", result, key)
+	}
+	if _, err := UnwrapKey(NewDataKey(), wrapped, []byte("context")); err == nil {
+		t.Error("data key unwrapped with wrong master key")
+	}
+	if _, err := UnwrapKey(master, wrapped, []byte("other")); err == nil {
+		t.Error("data key unwrapped with wrong context")
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		start  int64
+		length int64
+		ok     bool
+		err    error
+	}{
+		{"", 0, 100, false, nil},
+		{"bytes=0-9", 0, 10, true, nil},
+		{"bytes=90-", 90, 10, true, nil},
+		{"bytes=-10", 90, 10, true, nil},
+		{"bytes=-200", 0, 100, true, nil},
+		{"bytes=50-500", 50, 50, true, nil},
+		{"bytes=100-", 0, 0, false, ErrInvalidRange},
+		{"bytes=0-1,5-6", 0, 100, false, nil},
+		{"bytes=9-1", 0, 100, false, nil},
+		{"items=0-1", 0, 100, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			start, length, ok, err := ParseRange(tt.header, 100)
+			if start != tt.start || length != tt.length || ok != tt.ok || err != tt.err {
+				t.Errorf("result was incorrect\ngot: %v %v %v %v\n\nwant: %v %v %v %v", start, length, ok, err, tt.start, tt.length, tt.ok, tt.err)
+			}
+		})
+	}
+	for _, header := range []string{"bytes=-5", "bytes=0-"} {
+		if _, _, ok, err := ParseRange(header, 0); ok || err != ErrInvalidRange {
+			t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v %v", ok, err, false, ErrInvalidRange)
+		}
+	}
+}
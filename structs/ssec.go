@@ -0,0 +1,70 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	SSECustomerPrefix           = "X-Amz-Server-Side-Encryption-Customer-"
+	SSECopySourceCustomerPrefix = "X-Amz-Copy-Source-Server-Side-Encryption-Customer-"
+)
+
+// ParseCustomerKey returns the SSE-C key of the headers with prefix or nil
+// if the request does not use customer provided keys.
+func ParseCustomerKey(header http.Header, prefix string) ([]byte, error) {
+	algorithm := header.Get(prefix + "Algorithm")
+	encoded := header.Get(prefix + "Key")
+	digest := header.Get(prefix + "Key-Md5")
+	if len(algorithm) == 0 && len(encoded) == 0 && len(digest) == 0 {
+		return nil, nil
+	}
+
+	if algorithm != "AES256" {
+		return nil, fmt.Errorf("unsupported customer encryption algorithm %q", algorithm)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("customer key must be a base64 encoded 256 bit key")
+	}
+	sum := md5.Sum(key)
+	if base64.StdEncoding.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("customer key MD5 does not match")
+	}
+	return key, nil
+}
+
+// HashCustomerKey returns a salted hash of a customer key, the key itself
+// is never stored.
+func HashCustomerKey(key []byte) string {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(salt) + ":" + customerKeyDigest(salt, key)
+}
+
+// VerifyCustomerKey checks a customer key against its salted hash.
+func VerifyCustomerKey(key []byte, hash string) bool {
+	encoded, digest, found := strings.Cut(hash, ":")
+	salt, err := base64.StdEncoding.DecodeString(encoded)
+	if !found || err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(customerKeyDigest(salt, key)), []byte(digest))
+}
+
+func customerKeyDigest(salt []byte, key []byte) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(key)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,80 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"net/http"
+	"testing"
+)
+
+func TestParseCustomerKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	sum := md5.Sum(key)
+	encoded := base64.StdEncoding.EncodeToString(key)
+	digest := base64.StdEncoding.EncodeToString(sum[:])
+
+	header := func(algorithm string, key string, digest string) http.Header {
+		h := http.Header{}
+		h.Set(SSECustomerPrefix+"Algorithm", algorithm)
+		h.Set(SSECustomerPrefix+"Key", key)
+		h.Set(SSECustomerPrefix+"Key-MD5", digest)
+		return h
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		result, err := ParseCustomerKey(header("AES256", encoded, digest), SSECustomerPrefix)
+		if err != nil || !bytes.Equal(result, key) {
+			t.Errorf("result was incorrect\ngot: %x %v\n\nwant: %x", result, err, key)
+		}
+	})
+
+	t.Run("absent", func(t *testing.T) {
+		result, err := ParseCustomerKey(http.Header{}, SSECustomerPrefix)
+		if result != nil || err != nil {
+			t.Errorf("result was incorrect\ngot: %x %v\n\nwant: nil", result, err)
+		}
+	})
+
+	t.Run("copy source prefix", func(t *testing.T) {
+		h := header("AES256", encoded, digest)
+		if result, _ := ParseCustomerKey(h, SSECopySourceCustomerPrefix); result != nil {
+			t.Errorf("result was incorrect\ngot: %x\n\nwant: nil", result)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{"algorithm", header("AES128", encoded, digest)},
+		{"short key", header("AES256", base64.StdEncoding.EncodeToString(key[:16]), digest)},
+		{"digest", header("AES256", encoded, base64.StdEncoding.EncodeToString(make([]byte, 16)))},
+		{"missing key", header("AES256", "", "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCustomerKey(tt.header, SSECustomerPrefix); err == nil {
+				t.Error("invalid customer key accepted")
+			}
+		})
+	}
+}
+
+func TestHashCustomerKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	hash := HashCustomerKey(key)
+
+	if !VerifyCustomerKey(key, hash) {
+		t.Error("customer key not verified")
+	}
+	if VerifyCustomerKey(bytes.Repeat([]byte{8}, 32), hash) {
+		t.Error("wrong customer key verified")
+	}
+	if hash == HashCustomerKey(key) {
+		t.Error("customer key hash is not salted")
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"encoding/xml"
+)
+
+const STSNamespace = "https://sts.amazonaws.com/doc/2011-06-15/"
+
+type STSCredentials struct {
+	AccessKeyID     string `xml:"AccessKeyId"`
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      string
+}
+
+type AssumedRoleUser struct {
+	Arn           string
+	AssumedRoleID string `xml:"AssumedRoleId"`
+}
+
+type ResponseMetadata struct {
+	RequestID string `xml:"RequestId"`
+}
+
+type AssumeRoleResponse struct {
+	XMLName xml.Name `xml:"AssumeRoleResponse"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Result  struct {
+		Credentials      STSCredentials
+		AssumedRoleUser  AssumedRoleUser
+		PackedPolicySize int `xml:"PackedPolicySize,omitempty"`
+	} `xml:"AssumeRoleResult"`
+	ResponseMetadata ResponseMetadata
+}
+
+type AssumeRoleWithWebIdentityResponse struct {
+	XMLName xml.Name `xml:"AssumeRoleWithWebIdentityResponse"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Result  struct {
+		Credentials                 STSCredentials
+		SubjectFromWebIdentityToken string
+		AssumedRoleUser             AssumedRoleUser
+		Provider                    string
+		Audience                    string
+	} `xml:"AssumeRoleWithWebIdentityResult"`
+	ResponseMetadata ResponseMetadata
+}
+
+type GetSessionTokenResponse struct {
+	XMLName xml.Name `xml:"GetSessionTokenResponse"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Result  struct {
+		Credentials STSCredentials
+	} `xml:"GetSessionTokenResult"`
+	ResponseMetadata ResponseMetadata
+}
+
+type STSErrorResponse struct {
+	XMLName xml.Name `xml:"ErrorResponse"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Error   struct {
+		Type    string
+		Code    string
+		Message string
+	}
+	RequestID string `xml:"RequestId"`
+}
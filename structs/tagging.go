@@ -0,0 +1,69 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaxObjectTags = 10
+	MaxBucketTags = 50
+)
+
+// ParseTaggingHeader parses the URL query encoded x-amz-tagging header.
+func ParseTaggingHeader(header string, max int) (map[string]string, error) {
+	values, err := url.ParseQuery(header)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x-amz-tagging header")
+	}
+
+	tags := []Tag{}
+	for k, v := range values {
+		if len(v) > 1 {
+			return nil, fmt.Errorf("tag key %q is not unique", k)
+		}
+		tags = append(tags, Tag{Key: k, Value: v[0]})
+	}
+	return TagMap(tags, max)
+}
+
+// TagMap validates a tag set against the S3 limits and returns it as a map.
+func TagMap(tags []Tag, max int) (map[string]string, error) {
+	if len(tags) > max {
+		return nil, fmt.Errorf("tag set can not have more than %d tags", max)
+	}
+
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		if l := utf8.RuneCountInString(tag.Key); l == 0 || l > 128 {
+			return nil, fmt.Errorf("tag key must be between 1 and 128 characters")
+		}
+		if utf8.RuneCountInString(tag.Value) > 256 {
+			return nil, fmt.Errorf("tag value can not be longer than 256 characters")
+		}
+		if strings.HasPrefix(strings.ToLower(tag.Key), "aws:") {
+			return nil, fmt.Errorf("tag keys can not start with aws:")
+		}
+		if _, ok := m[tag.Key]; ok {
+			return nil, fmt.Errorf("tag key %q is not unique", tag.Key)
+		}
+		m[tag.Key] = tag.Value
+	}
+	return m, nil
+}
+
+// TagSet returns tags sorted by key.
+func TagSet(tags map[string]string) []Tag {
+	set := make([]Tag, 0, len(tags))
+	for k, v := range tags {
+		set = append(set, Tag{Key: k, Value: v})
+	}
+	sort.Slice(set, func(i, j int) bool { return set[i].Key < set[j].Key })
+	return set
+}
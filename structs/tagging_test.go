@@ -0,0 +1,56 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTaggingHeader(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		result, err := ParseTaggingHeader("project=s3-go&cost%20center=42&empty=", MaxObjectTags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]string{"project": "s3-go", "cost center": "42", "empty": ""}
+		if !reflect.DeepEqual(expected, result) {
+			t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", result, expected)
+		}
+	})
+
+	tooMany := []string{}
+	for i := 0; i <= MaxObjectTags; i++ {
+		tooMany = append(tooMany, fmt.Sprintf("k%d=v", i))
+	}
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"too many", strings.Join(tooMany, "&")},
+		{"duplicate", "a=1&a=2"},
+		{"key too long", strings.Repeat("k", 129) + "=v"},
+		{"value too long", "k=" + strings.Repeat("v", 257)},
+		{"reserved", "aws:createdBy=me"},
+		{"malformed", "a=%zz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseTaggingHeader(tt.header, MaxObjectTags); err == nil {
+				t.Error("invalid tags accepted")
+			}
+		})
+	}
+}
+
+func TestTagSet(t *testing.T) {
+	result := TagSet(map[string]string{"b": "2", "a": "1"})
+	expected := []Tag{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("result was incorrect\ngot: %v\n\nwant: %v", result, expected)
+	}
+}
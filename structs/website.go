@@ -0,0 +1,105 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Validate checks a website configuration as S3 does on PUT.
+func (c *WebsiteConfiguration) Validate() error {
+	if c.RedirectAllRequestsTo != nil {
+		if c.IndexDocument != nil || c.ErrorDocument != nil || len(c.RoutingRules) > 0 {
+			return fmt.Errorf("RedirectAllRequestsTo can not be combined with other website settings")
+		}
+		if len(c.RedirectAllRequestsTo.HostName) == 0 {
+			return fmt.Errorf("RedirectAllRequestsTo requires a HostName")
+		}
+		return validProtocol(c.RedirectAllRequestsTo.Protocol)
+	}
+
+	if c.IndexDocument == nil {
+		return fmt.Errorf("IndexDocument is required")
+	}
+	if len(c.IndexDocument.Suffix) == 0 || strings.Contains(c.IndexDocument.Suffix, "/") {
+		return fmt.Errorf("IndexDocument suffix must not be empty or contain a slash")
+	}
+	if c.ErrorDocument != nil && len(c.ErrorDocument.Key) == 0 {
+		return fmt.Errorf("ErrorDocument requires a Key")
+	}
+
+	if len(c.RoutingRules) > 50 {
+		return fmt.Errorf("website configuration can not have more than 50 routing rules")
+	}
+	for _, rule := range c.RoutingRules {
+		r := rule.Redirect
+		if len(r.ReplaceKeyPrefixWith) > 0 && len(r.ReplaceKeyWith) > 0 {
+			return fmt.Errorf("ReplaceKeyPrefixWith and ReplaceKeyWith can not be combined")
+		}
+		if r.HttpRedirectCode != 0 && (r.HttpRedirectCode < 300 || r.HttpRedirectCode > 399) {
+			return fmt.Errorf("invalid HttpRedirectCode %d", r.HttpRedirectCode)
+		}
+		if err := validProtocol(r.Protocol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validProtocol(protocol string) error {
+	if protocol != "" && protocol != "http" && protocol != "https" {
+		return fmt.Errorf("invalid protocol %q", protocol)
+	}
+	return nil
+}
+
+// Route returns the first routing rule matching the key and the http status
+// code of the response, code is 0 before the object was looked up.
+func (c *WebsiteConfiguration) Route(key string, code int) *RoutingRule {
+	for i, rule := range c.RoutingRules {
+		cond := rule.Condition
+		if cond == nil {
+			if code == 0 {
+				return &c.RoutingRules[i]
+			}
+			continue
+		}
+		if cond.HttpErrorCodeReturnedEquals != code {
+			continue
+		}
+		if strings.HasPrefix(key, cond.KeyPrefixEquals) {
+			return &c.RoutingRules[i]
+		}
+	}
+	return nil
+}
+
+// Location returns the redirect target and status code of a routing rule
+// for a request to key on host.
+func (rule *RoutingRule) Location(key string, host string, protocol string) (string, int) {
+	r := rule.Redirect
+	switch {
+	case len(r.ReplaceKeyWith) > 0:
+		key = r.ReplaceKeyWith
+	case len(r.ReplaceKeyPrefixWith) > 0:
+		prefix := ""
+		if rule.Condition != nil {
+			prefix = rule.Condition.KeyPrefixEquals
+		}
+		key = r.ReplaceKeyPrefixWith + strings.TrimPrefix(key, prefix)
+	}
+	if len(r.HostName) > 0 {
+		host = r.HostName
+	}
+	if len(r.Protocol) > 0 {
+		protocol = r.Protocol
+	}
+	code := r.HttpRedirectCode
+	if code == 0 {
+		code = http.StatusMovedPermanently
+	}
+	return protocol + "://" + host + "/" + key, code
+}
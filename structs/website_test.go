@@ -0,0 +1,84 @@
+// Copyright (c) Autovia GmbH
+// SPDX-License-Identifier: Apache-2.0
+
+package structs
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestWebsiteConfigurationRoute(t *testing.T) {
+	body := `<WebsiteConfiguration>
+		<IndexDocument><Suffix>index.html</Suffix></IndexDocument>
+		<ErrorDocument><Key>404.html</Key></ErrorDocument>
+		<RoutingRules>
+			<RoutingRule>
+				<Condition><KeyPrefixEquals>docs/</KeyPrefixEquals></Condition>
+				<Redirect><ReplaceKeyPrefixWith>documents/</ReplaceKeyPrefixWith></Redirect>
+			</RoutingRule>
+			<RoutingRule>
+				<Condition><HttpErrorCodeReturnedEquals>404</HttpErrorCodeReturnedEquals></Condition>
+				<Redirect><HostName>fallback.example.com</HostName><Protocol>https</Protocol><HttpRedirectCode>302</HttpRedirectCode></Redirect>
+			</RoutingRule>
+		</RoutingRules>
+	</WebsiteConfiguration>`
+
+	var config WebsiteConfiguration
+	if err := xml.Unmarshal([]byte(body), &config); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("result was incorrect\ngot: %v\n\nwant: nil", err)
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		code     int
+		location string
+		status   int
+	}{
+		{"prefix", "docs/a.html", 0, "http://site/documents/a.html", 301},
+		{"not found", "missing.html", 404, "https://fallback.example.com/missing.html", 302},
+		{"no rule", "index.html", 0, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := config.Route(tt.key, tt.code)
+			if rule == nil {
+				if len(tt.location) > 0 {
+					t.Errorf("result was incorrect\ngot: nil\n\nwant: %v", tt.location)
+				}
+				return
+			}
+			location, status := rule.Location(tt.key, "site", "http")
+			if location != tt.location || status != tt.status {
+				t.Errorf("result was incorrect\ngot: %v %v\n\nwant: %v %v", location, status, tt.location, tt.status)
+			}
+		})
+	}
+}
+
+func TestWebsiteConfigurationValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"no index", `<WebsiteConfiguration><ErrorDocument><Key>e.html</Key></ErrorDocument></WebsiteConfiguration>`},
+		{"index with slash", `<WebsiteConfiguration><IndexDocument><Suffix>a/index.html</Suffix></IndexDocument></WebsiteConfiguration>`},
+		{"redirect all combined", `<WebsiteConfiguration><RedirectAllRequestsTo><HostName>a</HostName></RedirectAllRequestsTo><IndexDocument><Suffix>index.html</Suffix></IndexDocument></WebsiteConfiguration>`},
+		{"protocol", `<WebsiteConfiguration><RedirectAllRequestsTo><HostName>a</HostName><Protocol>ftp</Protocol></RedirectAllRequestsTo></WebsiteConfiguration>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config WebsiteConfiguration
+			if err := xml.Unmarshal([]byte(tt.body), &config); err != nil {
+				t.Fatal(err)
+			}
+			if err := config.Validate(); err == nil {
+				t.Error("invalid configuration accepted")
+			}
+		})
+	}
+}